@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"regexp"
+
+	"sigs.k8s.io/yaml"
 )
 
 // App struct
@@ -30,11 +33,29 @@ type Node struct {
 	Data     map[string]interface{} `json:"data"`
 }
 
-// Edge represents a connection between nodes
+// EdgeKind distinguishes a data-flow edge (an input value dependency)
+// from a control-flow edge (an execution-order dependency, e.g. the
+// EntryPoint chain). Only data edges participate in detectDataCycles:
+// a control-flow loop (While, For) is a legal cycle in the node graph.
+type EdgeKind string
+
+const (
+	EdgeKindData    EdgeKind = "data"
+	EdgeKindControl EdgeKind = "control"
+)
+
+// Edge represents a connection between nodes. SourcePort/TargetPort name
+// the specific ports the edge connects on each side (e.g. a BinaryOp's
+// "left"/"right" inputs, a Call's "arg0"); buildGraph falls back to the
+// generic "output"/"input" ports when either is left empty, which is
+// enough for a simple linear chain of single-input nodes.
 type Edge struct {
-	ID     string `json:"id"`
-	Source string `json:"source"`
-	Target string `json:"target"`
+	ID         string   `json:"id"`
+	Source     string   `json:"source"`
+	Target     string   `json:"target"`
+	Kind       EdgeKind `json:"kind,omitempty"`
+	SourcePort string   `json:"sourcePort,omitempty"`
+	TargetPort string   `json:"targetPort,omitempty"`
 }
 
 // FlowData represents the complete flow graph
@@ -69,6 +90,186 @@ func (a *App) SaveFlow(nodesJSON string, edgesJSON string) (string, error) {
 	return string(result), nil
 }
 
+// LoadFlow parses a saved flow JSON string back into its nodes and edges
+// JSON strings, the inverse of SaveFlow.
+func (a *App) LoadFlow(flowJSON string) (string, string, error) {
+	var flowData FlowData
+	if err := json.Unmarshal([]byte(flowJSON), &flowData); err != nil {
+		return "", "", fmt.Errorf("failed to parse flow data: %w", err)
+	}
+
+	nodesJSON, err := json.Marshal(flowData.Nodes)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal nodes: %w", err)
+	}
+
+	edgesJSON, err := json.Marshal(flowData.Edges)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal edges: %w", err)
+	}
+
+	return string(nodesJSON), string(edgesJSON), nil
+}
+
+// Workspace bundles multiple named flows into a single project, so a
+// root flow's Import nodes can reference the others by name as modules
+// (see GraphCompiler.RegisterModuleGraph) instead of the editor only
+// ever holding one flow at a time.
+type Workspace struct {
+	Flows map[string]FlowData `json:"flows"`
+	Entry string              `json:"entry"`
+}
+
+// SaveWorkspace saves a multi-flow workspace to a JSON string, mirroring
+// SaveFlow but for a project with more than one graph.
+func (a *App) SaveWorkspace(workspaceJSON string) (string, error) {
+	var workspace Workspace
+	if err := json.Unmarshal([]byte(workspaceJSON), &workspace); err != nil {
+		return "", fmt.Errorf("failed to parse workspace: %w", err)
+	}
+
+	result, err := json.MarshalIndent(workspace, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal workspace: %w", err)
+	}
+
+	return string(result), nil
+}
+
+// LoadWorkspace parses a saved workspace JSON string back into a
+// Workspace, the inverse of SaveWorkspace, validating that Entry names
+// one of Flows.
+func (a *App) LoadWorkspace(workspaceJSON string) (Workspace, error) {
+	var workspace Workspace
+	if err := json.Unmarshal([]byte(workspaceJSON), &workspace); err != nil {
+		return Workspace{}, fmt.Errorf("failed to parse workspace: %w", err)
+	}
+
+	if _, ok := workspace.Flows[workspace.Entry]; !ok {
+		return Workspace{}, fmt.Errorf("workspace entry %q not found among flows", workspace.Entry)
+	}
+
+	return workspace, nil
+}
+
+// CompileGraphResult is the JSON-serializable result of App.CompileGraph.
+type CompileGraphResult struct {
+	Success      bool            `json:"success"`
+	SourceCode   string          `json:"sourceCode,omitempty"`
+	SourceMapV3  json.RawMessage `json:"sourceMapV3,omitempty"`
+	ErrorMessage string          `json:"errorMessage,omitempty"`
+}
+
+// CompileGraph compiles a node graph given as nodes/edges JSON into Sox
+// source, returning the result - source, a standard Source Map v3
+// document, or an error message - as a JSON string for the frontend.
+func (a *App) CompileGraph(nodesJSON string, edgesJSON string) string {
+	var nodes []Node
+	var edges []Edge
+
+	if err := json.Unmarshal([]byte(nodesJSON), &nodes); err != nil {
+		return marshalCompileGraphResult(CompileGraphResult{ErrorMessage: fmt.Sprintf("failed to parse nodes: %v", err)})
+	}
+	if err := json.Unmarshal([]byte(edgesJSON), &edges); err != nil {
+		return marshalCompileGraphResult(CompileGraphResult{ErrorMessage: fmt.Sprintf("failed to parse edges: %v", err)})
+	}
+
+	compiler := NewGraphCompiler()
+	source, sourceMap, err := compiler.CompileToSource(nodes, edges)
+	if err != nil {
+		return marshalCompileGraphResult(CompileGraphResult{ErrorMessage: err.Error()})
+	}
+
+	v3, err := sourceMap.ToV3JSON()
+	if err != nil {
+		return marshalCompileGraphResult(CompileGraphResult{ErrorMessage: fmt.Sprintf("failed to build source map: %v", err)})
+	}
+
+	return marshalCompileGraphResult(CompileGraphResult{
+		Success:     true,
+		SourceCode:  source,
+		SourceMapV3: v3,
+	})
+}
+
+// yamlLineRe extracts the 1-based line number goyaml reports in its error
+// messages (e.g. "yaml: line 3: mapping values are not allowed in this
+// context"), so yamlToJSONOrErr can surface a location alongside the
+// message instead of just forwarding the wrapped error text.
+var yamlLineRe = regexp.MustCompile(`line (\d+)`)
+
+// yamlToJSONOrErr converts a YAML document to JSON via sigs.k8s.io/yaml,
+// naming doc (e.g. "nodes") and the offending line, when the underlying
+// parser reports one, in any returned error.
+func yamlToJSONOrErr(yamlDoc []byte, doc string) ([]byte, error) {
+	out, err := yaml.YAMLToJSON(yamlDoc)
+	if err != nil {
+		if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+			return nil, fmt.Errorf("failed to parse %s YAML at line %s: %w", doc, m[1], err)
+		}
+		return nil, fmt.Errorf("failed to parse %s YAML: %w", doc, err)
+	}
+	return out, nil
+}
+
+// CompileGraphYAML is CompileGraph's YAML-input sibling: nodesYAML and
+// edgesYAML are converted to JSON before being unmarshaled, so []Node and
+// []Edge's JSON tags remain the single source of truth for the document
+// shape. This is what makes hand-authored graph fixtures practical to
+// maintain outside Go test files.
+func (a *App) CompileGraphYAML(nodesYAML string, edgesYAML string) string {
+	nodesJSON, err := yamlToJSONOrErr([]byte(nodesYAML), "nodes")
+	if err != nil {
+		return marshalCompileGraphResult(CompileGraphResult{ErrorMessage: err.Error()})
+	}
+
+	edgesJSON, err := yamlToJSONOrErr([]byte(edgesYAML), "edges")
+	if err != nil {
+		return marshalCompileGraphResult(CompileGraphResult{ErrorMessage: err.Error()})
+	}
+
+	return a.CompileGraph(string(nodesJSON), string(edgesJSON))
+}
+
+// marshalCompileGraphResult marshals result to JSON, falling back to a
+// plain error payload in the unexpected case that marshaling itself fails.
+func marshalCompileGraphResult(result CompileGraphResult) string {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Sprintf(`{"success":false,"errorMessage":%q}`, err.Error())
+	}
+	return string(raw)
+}
+
+// GraphToDot renders a node graph given as nodes/edges JSON to Graphviz
+// DOT, for a frontend "export as DOT" debugging action. Unlike
+// CompileGraph, it only needs buildGraph to succeed - an invalid graph
+// (missing EntryPoint, a data cycle) still renders, with any data cycle
+// highlighted in red, so the DOT export can be used to diagnose the
+// validation failure itself.
+func (a *App) GraphToDot(nodesJSON string, edgesJSON string) (string, error) {
+	var nodes []Node
+	var edges []Edge
+
+	if err := json.Unmarshal([]byte(nodesJSON), &nodes); err != nil {
+		return "", fmt.Errorf("failed to parse nodes: %w", err)
+	}
+	if err := json.Unmarshal([]byte(edgesJSON), &edges); err != nil {
+		return "", fmt.Errorf("failed to parse edges: %w", err)
+	}
+
+	compiler := NewGraphCompiler()
+	if err := compiler.buildGraph(nodes, edges); err != nil {
+		return "", fmt.Errorf("failed to build graph: %w", err)
+	}
+	// Best effort: a missing EntryPoint keeps executionOrder empty rather
+	// than failing Dot outright; topologicalSort does not reject a data
+	// cycle, so a cyclic graph still gets an execution order.
+	_ = compiler.topologicalSort()
+
+	return string(compiler.Dot(&DotOpts{ExecutionOrder: true})), nil
+}
+
 // ValidateFlow validates the flow graph
 func (a *App) ValidateFlow(nodesJSON string, edgesJSON string) (bool, string) {
 	var nodes []Node
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// update rewrites every case under testdata/golden to match the
+// compiler's current output, instead of diffing against it. Run with:
+//
+//	go test ./sox_ui/... -run TestGolden -update
+var update = flag.Bool("update", false, "rewrite golden files in testdata/golden to match current output")
+
+// goldenCase is the on-disk shape of a testdata/golden/<name>/graph.json
+// fixture.
+type goldenCase struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// TestGolden compiles every fixture under testdata/golden and diffs the
+// generated source and Source Map v3 JSON against that fixture's
+// expected.sox and expected.sourcemap.json. Run with -update to rewrite
+// both files to match the compiler's current output.
+func TestGolden(t *testing.T) {
+	const root = "testdata/golden"
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", root, err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		t.Run(name, func(t *testing.T) {
+			runGoldenCase(t, filepath.Join(root, name))
+		})
+	}
+}
+
+func runGoldenCase(t *testing.T, dir string) {
+	t.Helper()
+
+	raw, err := os.ReadFile(filepath.Join(dir, "graph.json"))
+	if err != nil {
+		t.Fatalf("failed to read graph.json: %v", err)
+	}
+
+	var tc goldenCase
+	if err := json.Unmarshal(raw, &tc); err != nil {
+		t.Fatalf("failed to parse graph.json: %v", err)
+	}
+
+	compiler := NewGraphCompiler()
+	if err := compiler.buildGraph(tc.Nodes, tc.Edges); err != nil {
+		t.Fatalf("buildGraph failed: %v", err)
+	}
+
+	if result := compiler.validateGraph(); !result.IsValid {
+		t.Fatalf("validation failed: %v", result.Errors)
+	}
+	if err := compiler.topologicalSort(); err != nil {
+		t.Fatalf("topologicalSort failed: %v", err)
+	}
+	source, err := compiler.generateSource()
+	if err != nil {
+		t.Fatalf("generateSource failed: %v", err)
+	}
+	if len(compiler.errors) > 0 {
+		t.Fatalf("compilation errors: %v", compiler.errors)
+	}
+	compiler.sourceMap.GeneratedSource = source
+
+	assertNodeCoverage(t, tc.Nodes, compiler.sourceMap)
+
+	v3, err := compiler.sourceMap.ToV3JSON()
+	if err != nil {
+		t.Fatalf("ToV3JSON failed: %v", err)
+	}
+	v3Indented, err := indentJSON(v3)
+	if err != nil {
+		t.Fatalf("failed to indent source map: %v", err)
+	}
+
+	if *update {
+		writeGoldenFile(t, filepath.Join(dir, "expected.sox"), []byte(source))
+		writeGoldenFile(t, filepath.Join(dir, "expected.sourcemap.json"), v3Indented)
+		return
+	}
+
+	wantSource := readGoldenFile(t, filepath.Join(dir, "expected.sox"))
+	if source != string(wantSource) {
+		t.Errorf("generated source does not match %s (run with -update to refresh):\n--- got ---\n%s\n--- want ---\n%s", filepath.Join(dir, "expected.sox"), source, wantSource)
+	}
+
+	wantSourceMap := readGoldenFile(t, filepath.Join(dir, "expected.sourcemap.json"))
+	if string(v3Indented) != string(wantSourceMap) {
+		t.Errorf("source map does not match %s (run with -update to refresh):\n--- got ---\n%s\n--- want ---\n%s", filepath.Join(dir, "expected.sourcemap.json"), v3Indented, wantSourceMap)
+	}
+}
+
+// noMappingNodeTypes are node types that never own a generated statement
+// (buildStmtForNode returns nil for them, or - for EntryPoint - the node
+// is skipped outright), so assertNodeCoverage doesn't expect a
+// SourceMapping for them.
+var noMappingNodeTypes = map[string]bool{
+	"EntryPoint":   true,
+	"NumberNode":   true,
+	"StringNode":   true,
+	"BooleanNode":  true,
+	"GetVar":       true,
+	"BinaryOp":     true,
+	"Compare":      true,
+	"UnaryOp":      true,
+	"ModuleMember": true,
+	"Add":          true,
+	"Subtract":     true,
+	"Multiply":     true,
+	"Divide":       true,
+}
+
+// assertNodeCoverage fails t if any node in nodes that's expected to own
+// a generated statement has no SourceMapping in sm, catching a
+// regression where a node silently drops out of the generated source
+// without failing compilation outright.
+func assertNodeCoverage(t *testing.T, nodes []Node, sm *SourceMap) {
+	t.Helper()
+
+	mapped := make(map[string]bool, len(sm.Mappings))
+	for _, m := range sm.Mappings {
+		mapped[m.NodeID] = true
+	}
+
+	for _, node := range nodes {
+		if noMappingNodeTypes[node.Type] {
+			continue
+		}
+		if !mapped[node.ID] {
+			t.Errorf("node %s (%s) has no source map coverage", node.ID, node.Type)
+		}
+	}
+}
+
+// indentJSON re-indents raw with a two-space indent, the canonical form
+// golden fixtures are stored in so they diff cleanly.
+func indentJSON(raw []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func readGoldenFile(t *testing.T, path string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file %s: %v (run with -update to create it)", path, err)
+	}
+	return raw
+}
+
+func writeGoldenFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatalf("failed to write golden file %s: %v", path, err)
+	}
+}
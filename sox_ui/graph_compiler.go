@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -13,6 +15,47 @@ type GraphCompiler struct {
 	errors         []CompilationError
 	sourceMap      *SourceMap
 	executionOrder []*CompiledNode
+	modules        ModuleMap
+
+	// importStack holds the names of modules currently being inlined, so
+	// resolveImport can detect a graph module that (transitively)
+	// imports itself.
+	importStack []string
+}
+
+// ModuleEntry is one entry in a GraphCompiler's ModuleMap: a module is
+// either a precompiled Sox source snippet imported verbatim via
+// `import(...)`, or another FlowData graph inlined and compiled at the
+// import site. A non-empty Flow takes precedence over Source.
+type ModuleEntry struct {
+	Source string
+	Flow   FlowData
+}
+
+// ModuleMap is a GraphCompiler's registry of modules available to Import
+// nodes, keyed by module name - analogous to Tengo's objects.ModuleMap.
+type ModuleMap map[string]*ModuleEntry
+
+// RegisterModuleSource registers src as the precompiled Sox source for
+// module name. An Import node referencing name compiles to a plain
+// `alias := import("name")`, trusting the Sox runtime's module loader to
+// supply src under that name.
+func (gc *GraphCompiler) RegisterModuleSource(name string, src string) {
+	if gc.modules == nil {
+		gc.modules = make(ModuleMap)
+	}
+	gc.modules[name] = &ModuleEntry{Source: src}
+}
+
+// RegisterModuleGraph registers flow as a subgraph module under name. An
+// Import node referencing name is resolved by recursively compiling flow
+// into a namespaced scope at the import site, rather than relying on a
+// runtime module loader.
+func (gc *GraphCompiler) RegisterModuleGraph(name string, flow FlowData) {
+	if gc.modules == nil {
+		gc.modules = make(ModuleMap)
+	}
+	gc.modules[name] = &ModuleEntry{Flow: flow}
 }
 
 // CompiledNode wraps a node with compilation metadata
@@ -42,6 +85,23 @@ type Scope struct {
 	Variables map[string]*Variable
 	Parent    *Scope
 	Depth     int
+
+	// IsFunctionScope marks a scope pushed for a FunctionDef body. GetVar
+	// uses this to tell a closure-capturing reference (crosses a function
+	// boundary) apart from an ordinary block-nested reference.
+	IsFunctionScope bool
+
+	// SymbolInit records which names have been declared so far in this
+	// scope, in source order, mirroring Tengo's compile-time use-before-init
+	// check: a GetVar/SetVar for a name not yet in SymbolInit anywhere in
+	// the scope chain is unbound at this point in the program.
+	SymbolInit map[string]bool
+
+	// Captures records, for a function scope, the names of outer-scope
+	// locals a GetVar/SetVar inside this function resolved across its
+	// boundary. FunctionDef reads this back off the scope it pushed to
+	// populate FuncDeclStmt.Captures.
+	Captures map[string]bool
 }
 
 // Variable tracks a variable's metadata
@@ -65,6 +125,222 @@ type SourceMapping struct {
 	SourceColumn int
 	NodeID       string
 	NodePort     string
+
+	// Module is the name of the module the mapping was compiled under, or
+	// "" for the root graph. A line inlined from a RegisterModuleGraph
+	// subgraph carries the registered module name of the Import node that
+	// pulled it in (not its alias).
+	Module string
+}
+
+// sourceMapV3 is the on-the-wire shape of a Source Map Revision 3
+// document (https://sourcemaps.info/spec.html). Sources are the NodeIDs
+// referenced by a mapping; Names are the distinct NodePort values seen
+// (a segment only carries a nameIndex when its mapping named a port).
+// Sox graphs have no original text positions, so originalLine/Column are
+// always 0.
+type sourceMapV3 struct {
+	Version  int      `json:"version"`
+	Sources  []string `json:"sources"`
+	Names    []string `json:"names"`
+	Mappings string   `json:"mappings"`
+}
+
+// base64VLQChars is the alphabet used by the Source Map v3 "mappings"
+// field's Base64 VLQ segment encoding.
+const base64VLQChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// encodeVLQ encodes a signed integer as Base64 VLQ, the scheme Source Map
+// v3 uses for every field of a mappings segment.
+func encodeVLQ(value int) string {
+	unsigned := value << 1
+	if value < 0 {
+		unsigned = (-value << 1) | 1
+	}
+
+	var out strings.Builder
+	for {
+		digit := unsigned & 0x1f
+		unsigned >>= 5
+		if unsigned > 0 {
+			digit |= 0x20
+		}
+		out.WriteByte(base64VLQChars[digit])
+		if unsigned == 0 {
+			break
+		}
+	}
+	return out.String()
+}
+
+// decodeVLQ decodes one Base64 VLQ value from the start of s, returning
+// the value and the unconsumed remainder of s.
+func decodeVLQ(s string) (int, string, error) {
+	result := 0
+	shift := uint(0)
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(base64VLQChars, s[i])
+		if digit < 0 {
+			return 0, "", fmt.Errorf("invalid VLQ character %q in %q", s[i], s)
+		}
+		result |= (digit & 0x1f) << shift
+		if digit&0x20 == 0 {
+			if result&1 == 1 {
+				return -(result >> 1), s[i+1:], nil
+			}
+			return result >> 1, s[i+1:], nil
+		}
+		shift += 5
+	}
+	return 0, "", fmt.Errorf("unterminated VLQ sequence: %q", s)
+}
+
+// decodeVLQFields decodes every VLQ value packed into a single mappings
+// segment (the comma-delimited pieces of a "mappings" group).
+func decodeVLQFields(segment string) ([]int, error) {
+	var fields []int
+	for rest := segment; rest != ""; {
+		value, remainder, err := decodeVLQ(rest)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, value)
+		rest = remainder
+	}
+	return fields, nil
+}
+
+// v3Segment is one decoded Source Map v3 mapping segment, with every
+// field resolved to its absolute value (the on-the-wire form stores
+// deltas from the previous segment; see decodeMappingsV3).
+type v3Segment struct {
+	GeneratedColumn int
+	SourceIndex     int
+	OriginalLine    int
+	OriginalColumn  int
+	NameIndex       int
+	HasName         bool
+}
+
+// decodeMappingsV3 decodes a Source Map v3 "mappings" string into one
+// slice of segments per generated line. generatedColumn resets to 0 at
+// the start of every line; the other fields are cumulative across the
+// whole document, per spec.
+func decodeMappingsV3(mappings string) ([][]v3Segment, error) {
+	var lines [][]v3Segment
+	sourceIndex, originalLine, originalColumn, nameIndex := 0, 0, 0, 0
+
+	for _, group := range strings.Split(mappings, ";") {
+		var segments []v3Segment
+		generatedColumn := 0
+
+		if group != "" {
+			for _, raw := range strings.Split(group, ",") {
+				fields, err := decodeVLQFields(raw)
+				if err != nil {
+					return nil, err
+				}
+				if len(fields) != 4 && len(fields) != 5 {
+					return nil, fmt.Errorf("invalid mapping segment %q: want 4 or 5 fields, got %d", raw, len(fields))
+				}
+
+				generatedColumn += fields[0]
+				sourceIndex += fields[1]
+				originalLine += fields[2]
+				originalColumn += fields[3]
+
+				seg := v3Segment{
+					GeneratedColumn: generatedColumn,
+					SourceIndex:     sourceIndex,
+					OriginalLine:    originalLine,
+					OriginalColumn:  originalColumn,
+				}
+				if len(fields) == 5 {
+					nameIndex += fields[4]
+					seg.NameIndex = nameIndex
+					seg.HasName = true
+				}
+				segments = append(segments, seg)
+			}
+		}
+
+		lines = append(lines, segments)
+	}
+
+	return lines, nil
+}
+
+// ToV3JSON renders the SourceMap as a standard Source Map v3 JSON
+// document, suitable for any off-the-shelf source map consumer: Sources
+// holds the NodeID behind each mapped line, and Names holds any NodePort
+// those mappings named. Lines with no SourceMapping (closing braces
+// emitted by emitRaw) get an empty segment group, per spec.
+func (sm *SourceMap) ToV3JSON() ([]byte, error) {
+	lineToMapping := make(map[int]SourceMapping, len(sm.Mappings))
+	for _, m := range sm.Mappings {
+		if _, exists := lineToMapping[m.SourceLine]; !exists {
+			lineToMapping[m.SourceLine] = m
+		}
+	}
+
+	sourceIndexOf := make(map[string]int)
+	var sources []string
+	sourceFor := func(nodeID string) int {
+		if idx, ok := sourceIndexOf[nodeID]; ok {
+			return idx
+		}
+		idx := len(sources)
+		sourceIndexOf[nodeID] = idx
+		sources = append(sources, nodeID)
+		return idx
+	}
+
+	nameIndexOf := make(map[string]int)
+	var names []string
+	nameFor := func(name string) int {
+		if idx, ok := nameIndexOf[name]; ok {
+			return idx
+		}
+		idx := len(names)
+		nameIndexOf[name] = idx
+		names = append(names, name)
+		return idx
+	}
+
+	totalLines := strings.Count(sm.GeneratedSource, "\n")
+
+	var mappings strings.Builder
+	prevSource, prevColumn, prevName := 0, 0, 0
+	for genLine := 1; genLine <= totalLines; genLine++ {
+		if genLine > 1 {
+			mappings.WriteByte(';')
+		}
+		m, ok := lineToMapping[genLine]
+		if !ok {
+			continue
+		}
+
+		source := sourceFor(m.NodeID)
+		mappings.WriteString(encodeVLQ(0)) // generatedColumn: whole-line mapping, always column 0
+		mappings.WriteString(encodeVLQ(source - prevSource))
+		mappings.WriteString(encodeVLQ(0)) // originalLine: Sox graphs have no original text position
+		mappings.WriteString(encodeVLQ(m.SourceColumn - prevColumn))
+		prevSource = source
+		prevColumn = m.SourceColumn
+
+		if m.NodePort != "" {
+			name := nameFor(m.NodePort)
+			mappings.WriteString(encodeVLQ(name - prevName))
+			prevName = name
+		}
+	}
+
+	return json.Marshal(sourceMapV3{
+		Version:  3,
+		Sources:  sources,
+		Names:    names,
+		Mappings: mappings.String(),
+	})
 }
 
 // CompilationError represents an error during compilation
@@ -94,9 +370,10 @@ func NewGraphCompiler() *GraphCompiler {
 // NewSymbolTable creates a new symbol table
 func NewSymbolTable() *SymbolTable {
 	globalScope := &Scope{
-		Variables: make(map[string]*Variable),
-		Parent:    nil,
-		Depth:     0,
+		Variables:  make(map[string]*Variable),
+		Parent:     nil,
+		Depth:      0,
+		SymbolInit: make(map[string]bool),
 	}
 
 	return &SymbolTable{
@@ -105,6 +382,110 @@ func NewSymbolTable() *SymbolTable {
 	}
 }
 
+// currentScope returns the innermost active scope.
+func (st *SymbolTable) currentScope() *Scope {
+	return st.Scopes[len(st.Scopes)-1]
+}
+
+// PushScope opens a new lexical scope nested inside the current one.
+// isFunctionScope marks scopes opened for a FunctionDef body, which is
+// what lets GetVar distinguish an outer-block reference from a closure
+// capture.
+func (st *SymbolTable) PushScope(isFunctionScope bool) *Scope {
+	scope := &Scope{
+		Variables:       make(map[string]*Variable),
+		Parent:          st.currentScope(),
+		Depth:           st.CurrentDepth + 1,
+		IsFunctionScope: isFunctionScope,
+		SymbolInit:      make(map[string]bool),
+	}
+	st.Scopes = append(st.Scopes, scope)
+	st.CurrentDepth++
+	return scope
+}
+
+// PopScope closes the innermost scope, returning to its parent. The
+// global scope is never popped.
+func (st *SymbolTable) PopScope() {
+	if len(st.Scopes) <= 1 {
+		return
+	}
+	st.Scopes = st.Scopes[:len(st.Scopes)-1]
+	st.CurrentDepth--
+}
+
+// DeclareVar introduces a new variable in the current scope.
+func (st *SymbolTable) DeclareVar(name string) *Variable {
+	scope := st.currentScope()
+	v := &Variable{
+		Name:     name,
+		Index:    len(scope.Variables),
+		Depth:    scope.Depth,
+		IsGlobal: scope.Depth == 0,
+	}
+	scope.Variables[name] = v
+	scope.SymbolInit[name] = true
+	return v
+}
+
+// GetVar resolves name against the scope chain starting at the current
+// scope. If resolution crosses a function-scope boundary the variable is
+// marked IsCaptured so the generator can emit closure semantics for it.
+func (st *SymbolTable) GetVar(name string) (*Variable, bool) {
+	crossedFunction := false
+	for scope := st.currentScope(); scope != nil; scope = scope.Parent {
+		if v, ok := scope.Variables[name]; ok {
+			if crossedFunction && !v.IsGlobal {
+				v.IsCaptured = true
+				st.recordCapture(name)
+			}
+			return v, true
+		}
+		if scope.IsFunctionScope {
+			crossedFunction = true
+		}
+	}
+	return nil, false
+}
+
+// SetVar resolves name for assignment, applying the same capture tracking
+// as GetVar.
+func (st *SymbolTable) SetVar(name string) (*Variable, bool) {
+	return st.GetVar(name)
+}
+
+// recordCapture notes name as captured by the nearest function scope
+// enclosing the current scope - the function whose body is being compiled
+// when the capturing GetVar/SetVar fired, and so the one whose
+// FuncDeclStmt.Captures should list it.
+func (st *SymbolTable) recordCapture(name string) {
+	for scope := st.currentScope(); scope != nil; scope = scope.Parent {
+		if scope.IsFunctionScope {
+			if scope.Captures == nil {
+				scope.Captures = make(map[string]bool)
+			}
+			scope.Captures[name] = true
+			return
+		}
+	}
+}
+
+// nearestSymbols lists variable names visible from the current scope,
+// nearest-declared first, for use in unbound-symbol suggestions.
+func (st *SymbolTable) nearestSymbols() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for scope := st.currentScope(); scope != nil; scope = scope.Parent {
+		for name := range scope.Variables {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
 // CompileToSource compiles a graph to Sox source code
 func (gc *GraphCompiler) CompileToSource(nodes []Node, edges []Edge) (string, *SourceMap, error) {
 	// Phase 1: Build graph structure
@@ -128,6 +509,10 @@ func (gc *GraphCompiler) CompileToSource(nodes []Node, edges []Edge) (string, *S
 		return "", nil, err
 	}
 
+	if len(gc.errors) > 0 {
+		return "", nil, fmt.Errorf("compilation errors: %v", gc.errors)
+	}
+
 	gc.sourceMap.GeneratedSource = source
 	return source, gc.sourceMap, nil
 }
@@ -159,9 +544,16 @@ func (gc *GraphCompiler) buildGraph(nodes []Node, edges []Edge) error {
 			return fmt.Errorf("edge references non-existent target node: %s", edge.Target)
 		}
 
-		// Determine port names from edge data (or use defaults)
-		sourcePort := "output" // Default output port
-		targetPort := "input"  // Default input port
+		// Determine port names from the edge itself, falling back to the
+		// generic output/input ports for an edge that doesn't name one.
+		sourcePort := edge.SourcePort
+		if sourcePort == "" {
+			sourcePort = "output"
+		}
+		targetPort := edge.TargetPort
+		if targetPort == "" {
+			targetPort = "input"
+		}
 
 		// Add to outputs of source node
 		nodePort := NodePort{NodeID: edge.Target, PortName: targetPort}
@@ -223,47 +615,68 @@ func (gc *GraphCompiler) validateGraph() ValidationResult {
 	return result
 }
 
-// detectDataCycles detects cycles in data dependencies
-func (gc *GraphCompiler) detectDataCycles() error {
-	// Reset visited flags
-	for _, node := range gc.nodes {
-		node.Visited = false
-		node.InStack = false
+// edgeKind returns the edge's explicit Kind if set, otherwise infers one:
+// anything leaving an EntryPoint is control flow (the validator already
+// tolerates cycles there via While/For bodies looping back), everything
+// else is a data dependency.
+func (gc *GraphCompiler) edgeKind(edge Edge) EdgeKind {
+	if edge.Kind != "" {
+		return edge.Kind
+	}
+	if source, ok := gc.nodes[edge.Source]; ok && source.Node.Type == "EntryPoint" {
+		return EdgeKindControl
 	}
+	return EdgeKindData
+}
 
-	// DFS from each unvisited node
-	for _, node := range gc.nodes {
-		if !node.Visited {
-			if err := gc.detectCycleDFS(node); err != nil {
-				return err
-			}
+// dataAdjacency builds an adjacency list over data edges only, ignoring
+// control-flow edges entirely so that a legal While/For loop in the
+// control graph never trips cycle detection.
+func (gc *GraphCompiler) dataAdjacency() map[string][]string {
+	adj := make(map[string][]string)
+	for _, edge := range gc.edges {
+		if gc.edgeKind(edge) != EdgeKindData {
+			continue
 		}
+		adj[edge.Source] = append(adj[edge.Source], edge.Target)
 	}
-
-	return nil
+	return adj
 }
 
-// detectCycleDFS performs DFS for cycle detection
-func (gc *GraphCompiler) detectCycleDFS(node *CompiledNode) error {
-	node.Visited = true
-	node.InStack = true
-
-	// Visit all output nodes
-	for _, outputs := range node.Outputs {
-		for _, output := range outputs {
-			targetNode := gc.nodes[output.NodeID]
-
-			if !targetNode.Visited {
-				if err := gc.detectCycleDFS(targetNode); err != nil {
+// detectDataCycles detects cycles in data dependencies. Control-flow
+// edges are excluded (see edgeKind) so loop constructs don't false-positive.
+func (gc *GraphCompiler) detectDataCycles() error {
+	adj := gc.dataAdjacency()
+	visited := make(map[string]bool)
+	inStack := make(map[string]bool)
+
+	var visit func(id string) error
+	visit = func(id string) error {
+		visited[id] = true
+		inStack[id] = true
+
+		for _, next := range adj[id] {
+			if !visited[next] {
+				if err := visit(next); err != nil {
 					return err
 				}
-			} else if targetNode.InStack {
-				return fmt.Errorf("cycle detected involving node %s", node.Node.ID)
+			} else if inStack[next] {
+				return fmt.Errorf("cycle detected involving node %s", id)
+			}
+		}
+
+		inStack[id] = false
+		return nil
+	}
+
+	for id := range gc.nodes {
+		if !visited[id] {
+			if err := visit(id); err != nil {
+				return err
 			}
 		}
 	}
 
-	node.InStack = false
 	return nil
 }
 
@@ -281,6 +694,33 @@ func (gc *GraphCompiler) validateNodeType(node *CompiledNode) error {
 		if _, ok := node.Node.Data["name"]; !ok {
 			return fmt.Errorf("node %s: %s requires 'name' field", node.Node.ID, nodeType)
 		}
+	case "FunctionDef":
+		if _, ok := node.Node.Data["name"]; !ok {
+			return fmt.Errorf("node %s: %s requires 'name' field", node.Node.ID, nodeType)
+		}
+		if _, ok := node.Node.Data["body"]; !ok {
+			return fmt.Errorf("node %s: %s requires 'body' field", node.Node.ID, nodeType)
+		}
+	case "BinaryOp", "Compare", "UnaryOp":
+		if _, ok := node.Node.Data["op"]; !ok {
+			return fmt.Errorf("node %s: %s requires 'op' field", node.Node.ID, nodeType)
+		}
+	case "While":
+		if _, ok := node.Node.Data["body"]; !ok {
+			return fmt.Errorf("node %s: %s requires 'body' field", node.Node.ID, nodeType)
+		}
+	case "For":
+		if _, ok := node.Node.Data["body"]; !ok {
+			return fmt.Errorf("node %s: %s requires 'body' field", node.Node.ID, nodeType)
+		}
+	case "Import":
+		if _, ok := node.Node.Data["module"]; !ok {
+			return fmt.Errorf("node %s: %s requires 'module' field", node.Node.ID, nodeType)
+		}
+	case "ModuleMember":
+		if _, ok := node.Node.Data["member"]; !ok {
+			return fmt.Errorf("node %s: %s requires 'member' field", node.Node.ID, nodeType)
+		}
 	}
 
 	return nil
@@ -353,108 +793,769 @@ func (gc *GraphCompiler) topologicalSortDFS(node *CompiledNode) error {
 	return nil
 }
 
-// generateSource generates Sox source code from the ordered nodes
-func (gc *GraphCompiler) generateSource() (string, error) {
-	var source strings.Builder
-	currentLine := 1
+// Expr is an internal AST node that renders to a single inline Sox
+// expression (no statement terminator, no indentation of its own).
+type Expr interface{ exprNode() }
+
+// Stmt is an internal AST node that renders to one or more complete
+// lines of Sox source, each recorded in the SourceMap against NodeID.
+type Stmt interface{ stmtNode() }
+
+// Block is an ordered sequence of statements, used both for the
+// top-level program and for the bodies of If/While/For/FunctionDef.
+type Block struct {
+	Stmts []Stmt
+}
+
+// Literal is a pre-rendered literal value (number, string, or boolean).
+type Literal struct{ Value string }
+
+// VarRef references a previously declared variable by name.
+type VarRef struct{ Name string }
+
+// UnaryOp applies a prefix operator to a single operand, e.g. `!x`.
+type UnaryOp struct {
+	Op      string
+	Operand Expr
+}
+
+// BinaryOp applies an infix arithmetic/logical operator to two operands.
+type BinaryOp struct {
+	Op          string
+	Left, Right Expr
+}
+
+// CompareExpr applies an infix comparison operator (==, <, >= ...).
+type CompareExpr struct {
+	Op          string
+	Left, Right Expr
+}
+
+// CallExpr invokes a named function with zero or more arguments.
+type CallExpr struct {
+	Callee string
+	Args   []Expr
+}
+
+// MemberExpr accesses a member of a module or object value, e.g. the
+// `member` side of a ModuleMember node: `target.member`.
+type MemberExpr struct {
+	Target Expr
+	Member string
+}
+
+func (*Literal) exprNode()     {}
+func (*VarRef) exprNode()      {}
+func (*UnaryOp) exprNode()     {}
+func (*BinaryOp) exprNode()    {}
+func (*CompareExpr) exprNode() {}
+func (*CallExpr) exprNode()    {}
+func (*MemberExpr) exprNode()  {}
+
+// RawStmt is an already-rendered line (currently just the "unsupported
+// node type" fallback comment), emitted verbatim.
+type RawStmt struct {
+	NodeID string
+	Text   string
+}
+
+// VarDeclStmt declares a variable, optionally with an initializer.
+type VarDeclStmt struct {
+	NodeID string
+	Name   string
+	Value  Expr // nil for a bare `var x`
+}
+
+// AssignStmt assigns to a previously declared variable.
+type AssignStmt struct {
+	NodeID string
+	Name   string
+	Value  Expr
+}
+
+// ReturnStmt returns from the enclosing function, optionally with a value.
+type ReturnStmt struct {
+	NodeID string
+	Value  Expr // nil for a bare `return`
+}
+
+// ExprStmt evaluates an expression for its side effects, e.g. `print(x)`.
+type ExprStmt struct {
+	NodeID string
+	Expr   Expr
+}
+
+// IfStmt is a conditional with an optional else branch.
+type IfStmt struct {
+	NodeID string
+	Cond   Expr
+	Then   *Block
+	Else   *Block // nil when there's no else branch
+}
+
+// WhileStmt loops while Cond holds.
+type WhileStmt struct {
+	NodeID string
+	Cond   Expr
+	Body   *Block
+}
+
+// ForStmt is a classic C-style for loop; Init and Post may be nil.
+type ForStmt struct {
+	NodeID string
+	Init   Stmt
+	Cond   Expr
+	Post   Stmt
+	Body   *Block
+}
+
+// FuncDeclStmt declares a named function. Captures lists, in sorted
+// order, the outer-scope locals the body references (Variable.IsCaptured
+// on the originals) - populated by the SymbolTable as the body compiles,
+// and printed as an explicit closure clause so a reader can see what the
+// function closes over without tracing every GetVar in its body.
+type FuncDeclStmt struct {
+	NodeID   string
+	Name     string
+	Params   []string
+	Body     *Block
+	Captures []string
+}
+
+// ImportStmt imports a precompiled module by name, trusting the Sox
+// runtime's module loader to resolve ModuleName. Used when the Import
+// node's module was registered with RegisterModuleSource.
+type ImportStmt struct {
+	NodeID     string
+	Alias      string
+	ModuleName string
+}
 
-	// Generate code for each node in execution order
+// ModuleImportStmt inlines a subgraph module registered with
+// RegisterModuleGraph: Body is compiled in its own namespaced scope and
+// wrapped as an immediately-invoked function so Alias binds to whatever
+// it returns.
+type ModuleImportStmt struct {
+	NodeID     string
+	Alias      string
+	ModuleName string
+	Body       *Block
+}
+
+func (*RawStmt) stmtNode()          {}
+func (*VarDeclStmt) stmtNode()      {}
+func (*AssignStmt) stmtNode()       {}
+func (*ReturnStmt) stmtNode()       {}
+func (*ExprStmt) stmtNode()         {}
+func (*IfStmt) stmtNode()           {}
+func (*WhileStmt) stmtNode()        {}
+func (*ForStmt) stmtNode()          {}
+func (*FuncDeclStmt) stmtNode()     {}
+func (*ImportStmt) stmtNode()       {}
+func (*ModuleImportStmt) stmtNode() {}
+
+// legacyBinaryOps maps the original fixed-function node types (from
+// before BinaryOp existed) onto the operator they implement, so existing
+// graphs built with them keep compiling.
+var legacyBinaryOps = map[string]string{
+	"Add":      "+",
+	"Subtract": "-",
+	"Multiply": "*",
+	"Divide":   "/",
+}
+
+// generateSource runs the compiler's two code-generation passes: build
+// an AST from executionOrder (pass 1), then pretty-print it to Sox
+// source while recording a SourceMapping per emitted line (pass 2).
+func (gc *GraphCompiler) generateSource() (string, error) {
+	block := &Block{}
 	for _, node := range gc.executionOrder {
 		// Skip entry point (it's just a marker)
 		if node.Node.Type == "EntryPoint" {
 			continue
 		}
 
-		// Track source mapping
-		gc.sourceMap.Mappings = append(gc.sourceMap.Mappings, SourceMapping{
-			SourceLine: currentLine,
-			NodeID:     node.Node.ID,
-		})
-
-		// Generate code based on node type
-		code, err := gc.generateNodeSource(node)
+		stmt, err := gc.buildStmtForNode(node)
 		if err != nil {
 			return "", fmt.Errorf("error generating code for node %s: %w", node.Node.ID, err)
 		}
-
-		if code != "" {
-			source.WriteString(code)
-			source.WriteString("\n")
-			currentLine++
+		if stmt != nil {
+			block.Stmts = append(block.Stmts, stmt)
 		}
 	}
 
-	return source.String(), nil
+	var out strings.Builder
+	line := 1
+	gc.printBlock(&out, block, 0, &line, "")
+	return out.String(), nil
 }
 
-// generateNodeSource generates source code for a single node
-func (gc *GraphCompiler) generateNodeSource(node *CompiledNode) (string, error) {
+// exprOnlyNodeTypes are node types buildExprForNode knows how to render
+// as a value but that never own a statement of their own - they're only
+// ever visited as an Expr child of whatever statement consumes them.
+// legacyBinaryOps' keys (Add, Subtract, Multiply, Divide) are exactly
+// such a type too, checked alongside this map wherever it's consulted.
+var exprOnlyNodeTypes = map[string]bool{
+	"NumberNode":   true,
+	"StringNode":   true,
+	"BooleanNode":  true,
+	"GetVar":       true,
+	"BinaryOp":     true,
+	"Compare":      true,
+	"UnaryOp":      true,
+	"ModuleMember": true,
+}
+
+// buildStmtForNode builds the Stmt for a single node. A node in
+// exprOnlyNodeTypes (or legacyBinaryOps) produces no statement of its
+// own; a "default" node type no case below recognizes produces a
+// "// Unsupported node type" comment so it doesn't silently vanish.
+func (gc *GraphCompiler) buildStmtForNode(node *CompiledNode) (Stmt, error) {
 	switch node.Node.Type {
-	case "NumberNode":
-		// Number literals will be used inline in expressions
-		return "", nil
+	case "Print":
+		if _, ok := node.Inputs["value"]; !ok {
+			return nil, fmt.Errorf("Print node missing value input")
+		}
+		return &ExprStmt{
+			NodeID: node.Node.ID,
+			Expr:   &CallExpr{Callee: "print", Args: []Expr{gc.buildExprInput(node, "value")}},
+		}, nil
 
-	case "StringNode":
-		// String literals will be used inline in expressions
-		return "", nil
+	case "DeclareVar":
+		name, _ := node.Node.Data["name"].(string)
+		gc.symbolTable.DeclareVar(name)
+		stmt := &VarDeclStmt{NodeID: node.Node.ID, Name: name}
+		if _, ok := node.Inputs["value"]; ok {
+			stmt.Value = gc.buildExprInput(node, "value")
+		}
+		return stmt, nil
 
-	case "BooleanNode":
-		// Boolean literals will be used inline
-		return "", nil
+	case "SetVar":
+		name, _ := node.Node.Data["name"].(string)
+		if _, ok := gc.symbolTable.SetVar(name); !ok {
+			gc.errors = append(gc.errors, gc.unboundSymbolError(node.Node.ID, name))
+		}
+		if _, ok := node.Inputs["value"]; !ok {
+			return nil, fmt.Errorf("SetVar node missing value input")
+		}
+		return &AssignStmt{NodeID: node.Node.ID, Name: name, Value: gc.buildExprInput(node, "value")}, nil
 
-	case "Print":
-		// Get the input value
-		if input, ok := node.Inputs["value"]; ok {
-			inputNode := gc.nodes[input.NodeID]
-			value := gc.getNodeValue(inputNode)
-			return fmt.Sprintf("print(%s)", value), nil
+	case "Return":
+		stmt := &ReturnStmt{NodeID: node.Node.ID}
+		if _, ok := node.Inputs["value"]; ok {
+			stmt.Value = gc.buildExprInput(node, "value")
+		}
+		return stmt, nil
+
+	case "Call":
+		if len(node.Outputs) > 0 {
+			// Its result feeds another node's input, which will render
+			// the call inline via buildExprForNode; emitting it again
+			// here as a bare statement would run it a second time.
+			return nil, nil
 		}
-		return "", fmt.Errorf("Print node missing value input")
+		return &ExprStmt{NodeID: node.Node.ID, Expr: gc.buildCallExpr(node)}, nil
 
-	case "DeclareVar":
+	case "If":
+		thenBlock, err := gc.buildNestedBlock(node, "then")
+		if err != nil {
+			return nil, err
+		}
+		var elseBlock *Block
+		if _, ok := node.Node.Data["else"]; ok {
+			elseBlock, err = gc.buildNestedBlock(node, "else")
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &IfStmt{
+			NodeID: node.Node.ID,
+			Cond:   gc.buildExprInput(node, "cond"),
+			Then:   thenBlock,
+			Else:   elseBlock,
+		}, nil
+
+	case "While":
+		body, err := gc.buildNestedBlock(node, "body")
+		if err != nil {
+			return nil, err
+		}
+		return &WhileStmt{NodeID: node.Node.ID, Cond: gc.buildExprInput(node, "cond"), Body: body}, nil
+
+	case "For":
+		init, err := gc.buildNestedStmt(node, "init")
+		if err != nil {
+			return nil, err
+		}
+		post, err := gc.buildNestedStmt(node, "post")
+		if err != nil {
+			return nil, err
+		}
+		body, err := gc.buildNestedBlock(node, "body")
+		if err != nil {
+			return nil, err
+		}
+		return &ForStmt{
+			NodeID: node.Node.ID,
+			Init:   init,
+			Cond:   gc.buildExprInput(node, "cond"),
+			Post:   post,
+			Body:   body,
+		}, nil
+
+	case "FunctionDef":
 		name, _ := node.Node.Data["name"].(string)
-		// Check if there's an initial value input
-		if input, ok := node.Inputs["value"]; ok {
-			inputNode := gc.nodes[input.NodeID]
-			value := gc.getNodeValue(inputNode)
-			return fmt.Sprintf("var %s = %s", name, value), nil
+		var params []string
+		if raw, ok := node.Node.Data["params"].([]interface{}); ok {
+			for _, p := range raw {
+				if s, ok := p.(string); ok {
+					params = append(params, s)
+				}
+			}
+		}
+
+		body, err := decodeFlowData(node.Node.Data["body"])
+		if err != nil {
+			return nil, fmt.Errorf("FunctionDef node %s: %w", node.Node.ID, err)
 		}
-		return fmt.Sprintf("var %s", name), nil
 
+		scope := gc.symbolTable.PushScope(true)
+		defer gc.symbolTable.PopScope()
+		for _, p := range params {
+			gc.symbolTable.DeclareVar(p)
+		}
+
+		bodyBlock, err := gc.compileSubFlowToBlock(body)
+		if err != nil {
+			return nil, err
+		}
+
+		captures := make([]string, 0, len(scope.Captures))
+		for name := range scope.Captures {
+			captures = append(captures, name)
+		}
+		sort.Strings(captures)
+
+		return &FuncDeclStmt{NodeID: node.Node.ID, Name: name, Params: params, Body: bodyBlock, Captures: captures}, nil
+
+	case "Import":
+		return gc.resolveImport(node)
+
+	default:
+		if exprOnlyNodeTypes[node.Node.Type] {
+			return nil, nil
+		}
+		if _, ok := legacyBinaryOps[node.Node.Type]; ok {
+			return nil, nil
+		}
+		return &RawStmt{NodeID: node.Node.ID, Text: fmt.Sprintf("// Unsupported node type: %s", node.Node.Type)}, nil
+	}
+}
+
+// buildNestedBlock decodes a node's Data[key] as a nested FlowData (the
+// convention FunctionDef established for function bodies, reused here for
+// If/While/For branches and bodies) and compiles it into a Block.
+func (gc *GraphCompiler) buildNestedBlock(node *CompiledNode, key string) (*Block, error) {
+	raw, ok := node.Node.Data[key]
+	if !ok {
+		return &Block{}, nil
+	}
+	flow, err := decodeFlowData(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s node %s: %w", node.Node.Type, node.Node.ID, err)
+	}
+	return gc.compileSubFlowToBlock(flow)
+}
+
+// buildNestedStmt decodes a node's Data[key] as a single-statement nested
+// FlowData, used for a For loop's optional init/post clauses. It's an
+// error for the clause to compile to more than one statement: unlike
+// array position, "there's exactly one" is the only safe way to tell a
+// clause's real statement apart from value-only nodes that produce none.
+func (gc *GraphCompiler) buildNestedStmt(node *CompiledNode, key string) (Stmt, error) {
+	block, err := gc.buildNestedBlock(node, key)
+	if err != nil {
+		return nil, err
+	}
+	switch len(block.Stmts) {
+	case 0:
+		return nil, nil
+	case 1:
+		return block.Stmts[0], nil
 	default:
-		return fmt.Sprintf("// Unsupported node type: %s", node.Node.Type), nil
+		return nil, fmt.Errorf("%s node %s: %s clause must compile to a single statement, got %d", node.Node.Type, node.Node.ID, key, len(block.Stmts))
+	}
+}
+
+// decodeFlowData converts a node's raw Data["body"]-shaped value
+// (decoded from JSON as a generic map) back into a typed FlowData by
+// round-tripping through json, keeping json.Unmarshal into []Node/[]Edge
+// the single source of truth for the graph shape.
+func decodeFlowData(raw interface{}) (FlowData, error) {
+	var flow FlowData
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return flow, fmt.Errorf("invalid body: %w", err)
+	}
+	if err := json.Unmarshal(encoded, &flow); err != nil {
+		return flow, fmt.Errorf("invalid body: %w", err)
+	}
+	return flow, nil
+}
+
+// compileSubFlowToBlock compiles a nested FlowData (a function body or a
+// control-flow branch) into a Block, sharing this compiler's symbolTable
+// and error list so closures and unbound-symbol reporting work across the
+// nesting boundary.
+func (gc *GraphCompiler) compileSubFlowToBlock(flow FlowData) (*Block, error) {
+	sub := &GraphCompiler{
+		nodes:       make(map[string]*CompiledNode),
+		symbolTable: gc.symbolTable,
+		sourceMap:   gc.sourceMap,
+		errors:      []CompilationError{},
+		modules:     gc.modules,
+		importStack: append([]string{}, gc.importStack...),
+	}
+	if err := sub.buildGraph(flow.Nodes, flow.Edges); err != nil {
+		return nil, err
+	}
+	// Order the block by data/control dependency, the same way
+	// generateSource does for the top-level graph - walking flow.Nodes in
+	// raw input order would compile a node before one of its inputs just
+	// because the JSON happened to list it first.
+	if err := sub.topologicalSort(); err != nil {
+		return nil, err
 	}
+
+	block := &Block{}
+	for _, compiledNode := range sub.executionOrder {
+		if compiledNode.Node.Type == "EntryPoint" {
+			continue
+		}
+		stmt, err := sub.buildStmtForNode(compiledNode)
+		if err != nil {
+			return nil, err
+		}
+		if stmt != nil {
+			block.Stmts = append(block.Stmts, stmt)
+		}
+	}
+
+	gc.errors = append(gc.errors, sub.errors...)
+	return block, nil
 }
 
-// getNodeValue gets the value representation of a node
-func (gc *GraphCompiler) getNodeValue(node *CompiledNode) string {
+// buildExprInput resolves the node feeding the given input port into an
+// Expr, defaulting to a `nil` literal when the port isn't connected.
+func (gc *GraphCompiler) buildExprInput(node *CompiledNode, port string) Expr {
+	input, ok := node.Inputs[port]
+	if !ok {
+		return &Literal{Value: "nil"}
+	}
+	return gc.buildExprForNode(input.NodeID)
+}
+
+// buildExprForNode builds the Expr a node contributes when it's consulted
+// as a value (as opposed to compiled as a standalone statement).
+func (gc *GraphCompiler) buildExprForNode(nodeID string) Expr {
+	node, ok := gc.nodes[nodeID]
+	if !ok {
+		return &Literal{Value: "nil"}
+	}
+
 	switch node.Node.Type {
 	case "NumberNode":
 		if val, ok := node.Node.Data["value"].(float64); ok {
-			return fmt.Sprintf("%v", val)
+			return &Literal{Value: fmt.Sprintf("%v", val)}
 		}
 	case "StringNode":
 		if val, ok := node.Node.Data["value"].(string); ok {
-			return fmt.Sprintf(`"%s"`, val)
+			return &Literal{Value: fmt.Sprintf(`"%s"`, val)}
 		}
 	case "BooleanNode":
 		if val, ok := node.Node.Data["value"].(bool); ok {
-			return fmt.Sprintf("%v", val)
+			return &Literal{Value: fmt.Sprintf("%v", val)}
 		}
 	case "GetVar":
-		if name, ok := node.Node.Data["name"].(string); ok {
-			return name
+		name, _ := node.Node.Data["name"].(string)
+		if _, found := gc.symbolTable.GetVar(name); !found {
+			gc.errors = append(gc.errors, gc.unboundSymbolError(node.Node.ID, name))
+		}
+		return &VarRef{Name: name}
+	case "Call":
+		return gc.buildCallExpr(node)
+	case "UnaryOp":
+		op, _ := node.Node.Data["op"].(string)
+		return &UnaryOp{Op: op, Operand: gc.buildExprInput(node, "operand")}
+	case "Compare":
+		op, _ := node.Node.Data["op"].(string)
+		return &CompareExpr{Op: op, Left: gc.buildExprInput(node, "left"), Right: gc.buildExprInput(node, "right")}
+	case "BinaryOp":
+		op, _ := node.Node.Data["op"].(string)
+		return &BinaryOp{Op: op, Left: gc.buildExprInput(node, "left"), Right: gc.buildExprInput(node, "right")}
+	case "Import":
+		alias, _ := node.Node.Data["alias"].(string)
+		if alias == "" {
+			alias, _ = node.Node.Data["module"].(string)
+		}
+		return &VarRef{Name: alias}
+	case "ModuleMember":
+		member, _ := node.Node.Data["member"].(string)
+		return &MemberExpr{Target: gc.buildExprInput(node, "module"), Member: member}
+	default:
+		if op, ok := legacyBinaryOps[node.Node.Type]; ok {
+			return &BinaryOp{Op: op, Left: gc.buildExprInput(node, "left"), Right: gc.buildExprInput(node, "right")}
 		}
 	}
-	return "nil"
+	return &Literal{Value: "nil"}
 }
 
-// FindMapping finds the source mapping for a given line
-func (sm *SourceMap) FindMapping(line, column int) *SourceMapping {
-	for i := range sm.Mappings {
-		if sm.Mappings[i].SourceLine == line {
-			return &sm.Mappings[i]
+// buildCallExpr builds a CallExpr for a Call node. The callee is either
+// given directly as Data["callee"] or resolved from a "callee" input
+// port (e.g. a GetVar naming the function); arguments come from the
+// variadic "arg0", "arg1", ... input ports.
+func (gc *GraphCompiler) buildCallExpr(node *CompiledNode) *CallExpr {
+	callee, _ := node.Node.Data["callee"].(string)
+	if callee == "" {
+		if input, ok := node.Inputs["callee"]; ok {
+			if ref, ok := gc.buildExprForNode(input.NodeID).(*VarRef); ok {
+				callee = ref.Name
+			}
+		}
+	}
+
+	var args []Expr
+	for i := 0; ; i++ {
+		input, ok := node.Inputs[fmt.Sprintf("arg%d", i)]
+		if !ok {
+			break
+		}
+		args = append(args, gc.buildExprForNode(input.NodeID))
+	}
+
+	return &CallExpr{Callee: callee, Args: args}
+}
+
+// printExpr renders an Expr to inline Sox source. Binary and comparison
+// operators are always fully parenthesized so nested arithmetic never
+// depends on the target language's precedence rules.
+func printExpr(e Expr) string {
+	switch v := e.(type) {
+	case *Literal:
+		return v.Value
+	case *VarRef:
+		return v.Name
+	case *UnaryOp:
+		return fmt.Sprintf("%s%s", v.Op, printExpr(v.Operand))
+	case *BinaryOp:
+		return fmt.Sprintf("(%s %s %s)", printExpr(v.Left), v.Op, printExpr(v.Right))
+	case *CompareExpr:
+		return fmt.Sprintf("(%s %s %s)", printExpr(v.Left), v.Op, printExpr(v.Right))
+	case *CallExpr:
+		args := make([]string, len(v.Args))
+		for i, a := range v.Args {
+			args[i] = printExpr(a)
+		}
+		return fmt.Sprintf("%s(%s)", v.Callee, strings.Join(args, ", "))
+	case *MemberExpr:
+		return fmt.Sprintf("%s.%s", printExpr(v.Target), v.Member)
+	default:
+		return "nil"
+	}
+}
+
+// printBlock pretty-prints every statement in a block at the given
+// indentation depth. module is the name of the module the block was
+// inlined from ("" for the root graph), threaded down so emitLine can tag each
+// SourceMapping with it.
+func (gc *GraphCompiler) printBlock(out *strings.Builder, block *Block, depth int, line *int, module string) {
+	for _, stmt := range block.Stmts {
+		gc.printStmt(out, stmt, depth, line, module)
+	}
+}
+
+// emitLine writes one line of source at depth, recording a SourceMapping
+// against nodeID tagged with module.
+func (gc *GraphCompiler) emitLine(out *strings.Builder, depth int, line *int, module string, nodeID string, text string) {
+	out.WriteString(strings.Repeat("    ", depth))
+	out.WriteString(text)
+	out.WriteString("\n")
+	gc.sourceMap.Mappings = append(gc.sourceMap.Mappings, SourceMapping{SourceLine: *line, NodeID: nodeID, Module: module})
+	*line++
+}
+
+// emitRaw writes one line of source at depth without a SourceMapping,
+// for syntax (closing braces, `} else {`) that isn't owned by a node.
+func (gc *GraphCompiler) emitRaw(out *strings.Builder, depth int, line *int, text string) {
+	out.WriteString(strings.Repeat("    ", depth))
+	out.WriteString(text)
+	out.WriteString("\n")
+	*line++
+}
+
+// printStmt pretty-prints a single statement (and, for control-flow
+// statements, its nested blocks) at the given indentation depth. module
+// is passed through to emitLine; a ModuleImportStmt's own Body prints
+// under its ModuleName instead.
+func (gc *GraphCompiler) printStmt(out *strings.Builder, stmt Stmt, depth int, line *int, module string) {
+	switch s := stmt.(type) {
+	case *RawStmt:
+		gc.emitLine(out, depth, line, module, s.NodeID, s.Text)
+
+	case *VarDeclStmt:
+		text := "var " + s.Name
+		if s.Value != nil {
+			text += " = " + printExpr(s.Value)
+		}
+		gc.emitLine(out, depth, line, module, s.NodeID, text)
+
+	case *AssignStmt:
+		gc.emitLine(out, depth, line, module, s.NodeID, s.Name+" = "+printExpr(s.Value))
+
+	case *ReturnStmt:
+		text := "return"
+		if s.Value != nil {
+			text += " " + printExpr(s.Value)
+		}
+		gc.emitLine(out, depth, line, module, s.NodeID, text)
+
+	case *ExprStmt:
+		gc.emitLine(out, depth, line, module, s.NodeID, printExpr(s.Expr))
+
+	case *IfStmt:
+		gc.emitLine(out, depth, line, module, s.NodeID, "if "+printExpr(s.Cond)+" {")
+		gc.printBlock(out, s.Then, depth+1, line, module)
+		if s.Else != nil {
+			gc.emitRaw(out, depth, line, "} else {")
+			gc.printBlock(out, s.Else, depth+1, line, module)
+		}
+		gc.emitRaw(out, depth, line, "}")
+
+	case *WhileStmt:
+		gc.emitLine(out, depth, line, module, s.NodeID, "while "+printExpr(s.Cond)+" {")
+		gc.printBlock(out, s.Body, depth+1, line, module)
+		gc.emitRaw(out, depth, line, "}")
+
+	case *ForStmt:
+		init, post := "", ""
+		if s.Init != nil {
+			init = strings.TrimSpace(gc.renderStmtInline(s.Init))
 		}
+		if s.Post != nil {
+			post = strings.TrimSpace(gc.renderStmtInline(s.Post))
+		}
+		gc.emitLine(out, depth, line, module, s.NodeID, fmt.Sprintf("for %s; %s; %s {", init, printExpr(s.Cond), post))
+		gc.printBlock(out, s.Body, depth+1, line, module)
+		gc.emitRaw(out, depth, line, "}")
+
+	case *FuncDeclStmt:
+		name := s.Name
+		if len(s.Captures) > 0 {
+			name = fmt.Sprintf("%s[%s]", s.Name, strings.Join(s.Captures, ", "))
+		}
+		gc.emitLine(out, depth, line, module, s.NodeID, fmt.Sprintf("func %s(%s) {", name, strings.Join(s.Params, ", ")))
+		gc.printBlock(out, s.Body, depth+1, line, module)
+		gc.emitRaw(out, depth, line, "}")
+
+	case *ImportStmt:
+		gc.emitLine(out, depth, line, module, s.NodeID, fmt.Sprintf("%s := import(%q)", s.Alias, s.ModuleName))
+
+	case *ModuleImportStmt:
+		gc.emitLine(out, depth, line, module, s.NodeID, fmt.Sprintf("%s := func() {", s.Alias))
+		gc.printBlock(out, s.Body, depth+1, line, s.ModuleName)
+		gc.emitRaw(out, depth, line, "}()")
+	}
+}
+
+// renderStmtInline renders a statement as it would appear standalone,
+// without indentation or a trailing newline, for use inside a For
+// header's init/post clauses.
+func (gc *GraphCompiler) renderStmtInline(stmt Stmt) string {
+	switch s := stmt.(type) {
+	case *VarDeclStmt:
+		if s.Value != nil {
+			return "var " + s.Name + " = " + printExpr(s.Value)
+		}
+		return "var " + s.Name
+	case *AssignStmt:
+		return s.Name + " = " + printExpr(s.Value)
+	case *ExprStmt:
+		return printExpr(s.Expr)
+	default:
+		return ""
+	}
+}
+
+// resolveImport resolves an Import node against gc.modules. A module
+// registered with RegisterModuleSource compiles to a plain
+// `alias := import("name")`; one registered with RegisterModuleGraph is
+// recursively compiled into a namespaced scope at the import site,
+// detecting cyclic imports via gc.importStack along the way.
+func (gc *GraphCompiler) resolveImport(node *CompiledNode) (Stmt, error) {
+	moduleName, _ := node.Node.Data["module"].(string)
+	alias, _ := node.Node.Data["alias"].(string)
+	if alias == "" {
+		alias = moduleName
+	}
+
+	entry, ok := gc.modules[moduleName]
+	if !ok {
+		return nil, fmt.Errorf("Import node %s: unknown module %q", node.Node.ID, moduleName)
+	}
+
+	gc.symbolTable.DeclareVar(alias)
+
+	if len(entry.Flow.Nodes) == 0 {
+		return &ImportStmt{NodeID: node.Node.ID, Alias: alias, ModuleName: moduleName}, nil
+	}
+
+	for _, onStack := range gc.importStack {
+		if onStack == moduleName {
+			return nil, fmt.Errorf("Import node %s: cyclic import of %q (%s)",
+				node.Node.ID, moduleName, strings.Join(append(gc.importStack, moduleName), " -> "))
+		}
+	}
+
+	gc.importStack = append(gc.importStack, moduleName)
+	defer func() { gc.importStack = gc.importStack[:len(gc.importStack)-1] }()
+
+	gc.symbolTable.PushScope(true)
+	defer gc.symbolTable.PopScope()
+
+	body, err := gc.compileSubFlowToBlock(entry.Flow)
+	if err != nil {
+		return nil, fmt.Errorf("module %q: %w", moduleName, err)
+	}
+
+	return &ModuleImportStmt{NodeID: node.Node.ID, Alias: alias, ModuleName: moduleName, Body: body}, nil
+}
+
+// unboundSymbolError builds the CompilationError reported when a GetVar
+// or SetVar references a name that isn't declared anywhere in the
+// current scope chain, suggesting the nearest symbols actually in scope.
+func (gc *GraphCompiler) unboundSymbolError(nodeID string, name string) CompilationError {
+	suggestion := "declare the variable before referencing it"
+	if nearest := gc.symbolTable.nearestSymbols(); len(nearest) > 0 {
+		suggestion = fmt.Sprintf("did you mean one of: %s", strings.Join(nearest, ", "))
+	}
+	return CompilationError{
+		NodeID:     nodeID,
+		Message:    fmt.Sprintf("unbound symbol: %s", name),
+		Suggestion: suggestion,
+		ErrorType:  "unbound_symbol",
+	}
+}
+
+// FindMapping finds the source mapping for a given line. emitLine only
+// ever appends mappings in increasing SourceLine order as generateSource
+// walks the AST, so sm.Mappings is already sorted by line - a binary
+// search finds the match in O(log n) instead of scanning every mapping.
+func (sm *SourceMap) FindMapping(line, column int) *SourceMapping {
+	i := sort.Search(len(sm.Mappings), func(i int) bool {
+		return sm.Mappings[i].SourceLine >= line
+	})
+	if i < len(sm.Mappings) && sm.Mappings[i].SourceLine == line {
+		return &sm.Mappings[i]
 	}
 	return nil
 }
@@ -474,3 +1575,166 @@ func (gc *GraphCompiler) MapCompilerError(errorLine int, errorMessage string) Co
 		ErrorType: "compiler_error",
 	}
 }
+
+// MapCompilerErrorFromV3 is the symmetric counterpart to MapCompilerError:
+// given a standard Source Map v3 document (as produced by
+// SourceMap.ToV3JSON), it decodes the VLQ mappings itself to recover the
+// NodeID for errorLine, without needing the original SourceMap value.
+func (gc *GraphCompiler) MapCompilerErrorFromV3(v3JSON []byte, errorLine int, errorMessage string) (CompilationError, error) {
+	var doc sourceMapV3
+	if err := json.Unmarshal(v3JSON, &doc); err != nil {
+		return CompilationError{}, fmt.Errorf("invalid source map: %w", err)
+	}
+
+	lines, err := decodeMappingsV3(doc.Mappings)
+	if err != nil {
+		return CompilationError{}, fmt.Errorf("invalid mappings: %w", err)
+	}
+
+	nodeID := ""
+	if errorLine >= 1 && errorLine <= len(lines) && len(lines[errorLine-1]) > 0 {
+		if source := lines[errorLine-1][0].SourceIndex; source >= 0 && source < len(doc.Sources) {
+			nodeID = doc.Sources[source]
+		}
+	}
+
+	return CompilationError{
+		NodeID:    nodeID,
+		Message:   errorMessage,
+		ErrorType: "compiler_error",
+	}, nil
+}
+
+// DotOpts configures GraphCompiler.Dot's Graphviz export.
+type DotOpts struct {
+	// ExecutionOrder, when true, appends each node's resolved execution
+	// order (see topologicalSort) to its label. Nodes topologicalSort
+	// never reached (Order == -1) keep their ID/Type label with no order.
+	ExecutionOrder bool
+
+	// CompiledOnly, when true, restricts the export to nodes reachable
+	// from the EntryPoint (gc.executionOrder) instead of every node
+	// buildGraph saw, dropping edges to or from an excluded node.
+	CompiledOnly bool
+}
+
+// Dot renders the compiler's internal node/edge graph as a Graphviz
+// digraph: nodes are labeled with their ID and Type, data-flow edges
+// (e.g. left/right/value inputs) are drawn solid while control-flow
+// edges (the EntryPoint chain) are dashed, and any edge detectDataCycles
+// would flag as part of a data cycle is colored red. Call this after
+// buildGraph - directly, or via CompileToSource - so gc.nodes and
+// gc.edges are populated; it does not require a successful compile.
+func (gc *GraphCompiler) Dot(opts *DotOpts) []byte {
+	if opts == nil {
+		opts = &DotOpts{}
+	}
+
+	var included map[string]bool
+	if opts.CompiledOnly {
+		included = make(map[string]bool, len(gc.executionOrder))
+		for _, node := range gc.executionOrder {
+			included[node.Node.ID] = true
+		}
+	}
+
+	cyclic := gc.cyclicDataEdges()
+
+	var out strings.Builder
+	out.WriteString("digraph sox {\n")
+	out.WriteString("    rankdir=TB;\n")
+
+	for id, node := range gc.nodes {
+		if included != nil && !included[id] {
+			continue
+		}
+		fmt.Fprintf(&out, "    %q [label=\"%s\"];\n", id, gc.dotLabel(node, opts))
+	}
+
+	for _, edge := range gc.edges {
+		if included != nil && (!included[edge.Source] || !included[edge.Target]) {
+			continue
+		}
+		style := "solid"
+		if gc.edgeKind(edge) == EdgeKindControl {
+			style = "dashed"
+		}
+		color := "black"
+		if cyclic[edge.ID] {
+			color = "red"
+		}
+		fmt.Fprintf(&out, "    %q -> %q [style=%s, color=%s];\n", edge.Source, edge.Target, style, color)
+	}
+
+	out.WriteString("}\n")
+	return []byte(out.String())
+}
+
+// dotLabel builds a node's Graphviz label: its ID and Type (and, with
+// ExecutionOrder, its resolved order) joined by a literal "\n" line
+// break. Each piece is quoted and unquoted individually with %q so any
+// quotes or backslashes it contains are escaped correctly without
+// re-escaping the "\n" separator itself.
+func (gc *GraphCompiler) dotLabel(node *CompiledNode, opts *DotOpts) string {
+	parts := []string{node.Node.ID, node.Node.Type}
+	if opts.ExecutionOrder && node.Order >= 0 {
+		parts = append(parts, fmt.Sprintf("#%d", node.Order))
+	}
+
+	escaped := make([]string, len(parts))
+	for i, p := range parts {
+		quoted := fmt.Sprintf("%q", p)
+		escaped[i] = quoted[1 : len(quoted)-1]
+	}
+	return strings.Join(escaped, "\\n")
+}
+
+// cyclicDataEdges returns the set of edge IDs forming a back edge in the
+// data-dependency graph, mirroring detectDataCycles' DFS but recording
+// the offending edges instead of just erroring, so Dot can highlight them.
+func (gc *GraphCompiler) cyclicDataEdges() map[string]bool {
+	adjEdges := make(map[string][]Edge)
+	for _, edge := range gc.edges {
+		if gc.edgeKind(edge) != EdgeKindData {
+			continue
+		}
+		adjEdges[edge.Source] = append(adjEdges[edge.Source], edge)
+	}
+
+	flagged := make(map[string]bool)
+	visited := make(map[string]bool)
+	inStack := make(map[string]bool)
+
+	var visit func(id string)
+	visit = func(id string) {
+		visited[id] = true
+		inStack[id] = true
+
+		for _, edge := range adjEdges[id] {
+			if inStack[edge.Target] {
+				flagged[edge.ID] = true
+				continue
+			}
+			if !visited[edge.Target] {
+				visit(edge.Target)
+			}
+		}
+
+		inStack[id] = false
+	}
+
+	// Start the DFS from node IDs in sorted order rather than map order, so
+	// the same graph always flags the same back edge.
+	ids := make([]string, 0, len(gc.nodes))
+	for id := range gc.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if !visited[id] {
+			visit(id)
+		}
+	}
+
+	return flagged
+}
@@ -6,93 +6,6 @@ import (
 	"testing"
 )
 
-// TestHelloWorldCompilation tests basic "Hello World" graph compilation
-func TestHelloWorldCompilation(t *testing.T) {
-	nodes := []Node{
-		{
-			ID:   "entry",
-			Type: "EntryPoint",
-			Position: map[string]float64{
-				"x": 100,
-				"y": 100,
-			},
-			Data: map[string]interface{}{
-				"label": "Start",
-			},
-		},
-		{
-			ID:   "str1",
-			Type: "StringNode",
-			Position: map[string]float64{
-				"x": 100,
-				"y": 200,
-			},
-			Data: map[string]interface{}{
-				"label": "String",
-				"value": "Hello, World!",
-			},
-		},
-		{
-			ID:   "print1",
-			Type: "Print",
-			Position: map[string]float64{
-				"x": 100,
-				"y": 300,
-			},
-			Data: map[string]interface{}{
-				"label": "Print",
-			},
-		},
-	}
-
-	edges := []Edge{
-		{
-			ID:     "e1",
-			Source: "entry",
-			Target: "print1",
-		},
-		{
-			ID:     "e2",
-			Source: "str1",
-			Target: "print1",
-		},
-	}
-
-	compiler := NewGraphCompiler()
-	source, sourceMap, err := compiler.CompileToSource(nodes, edges)
-
-	if err != nil {
-		t.Fatalf("Compilation failed: %v", err)
-	}
-
-	expectedSource := `print("Hello, World!")`
-	if strings.TrimSpace(source) != expectedSource {
-		t.Errorf("Expected source:\n%s\nGot:\n%s", expectedSource, source)
-	}
-
-	// Verify source map
-	if sourceMap == nil {
-		t.Fatal("Source map is nil")
-	}
-
-	if len(sourceMap.Mappings) == 0 {
-		t.Error("Source map has no mappings")
-	}
-
-	// Verify mapping points to print node
-	foundPrintMapping := false
-	for _, mapping := range sourceMap.Mappings {
-		if mapping.NodeID == "print1" {
-			foundPrintMapping = true
-			break
-		}
-	}
-
-	if !foundPrintMapping {
-		t.Error("Source map missing mapping for print node")
-	}
-}
-
 // TestVariableDeclaration tests variable declaration compilation
 func TestVariableDeclaration(t *testing.T) {
 	nodes := []Node{
@@ -119,7 +32,7 @@ func TestVariableDeclaration(t *testing.T) {
 
 	edges := []Edge{
 		{ID: "e1", Source: "entry", Target: "var1"},
-		{ID: "e2", Source: "num1", Target: "var1"},
+		{ID: "e2", Source: "num1", Target: "var1", TargetPort: "value"},
 	}
 
 	compiler := NewGraphCompiler()
@@ -246,7 +159,7 @@ func TestCompileGraphJSON(t *testing.T) {
 
 	edges := []Edge{
 		{ID: "e1", Source: "entry", Target: "print1"},
-		{ID: "e2", Source: "str1", Target: "print1"},
+		{ID: "e2", Source: "str1", Target: "print1", TargetPort: "value"},
 	}
 
 	nodesJSON, _ := json.Marshal(nodes)
@@ -276,6 +189,11 @@ func TestSourceMapErrorMapping(t *testing.T) {
 			Type: "EntryPoint",
 			Data: map[string]interface{}{"label": "Start"},
 		},
+		{
+			ID:   "str1",
+			Type: "StringNode",
+			Data: map[string]interface{}{"value": "Test"},
+		},
 		{
 			ID:   "print1",
 			Type: "Print",
@@ -285,6 +203,7 @@ func TestSourceMapErrorMapping(t *testing.T) {
 
 	edges := []Edge{
 		{ID: "e1", Source: "entry", Target: "print1"},
+		{ID: "e2", Source: "str1", Target: "print1", TargetPort: "value"},
 	}
 
 	compiler := NewGraphCompiler()
@@ -316,6 +235,66 @@ func TestSourceMapErrorMapping(t *testing.T) {
 	}
 }
 
+// TestSourceMapV3 tests that ToV3JSON emits a standard Source Map v3
+// document whose mappings resolve back to the originating node.
+func TestSourceMapV3(t *testing.T) {
+	nodes := []Node{
+		{
+			ID:   "entry",
+			Type: "EntryPoint",
+			Data: map[string]interface{}{"label": "Start"},
+		},
+		{
+			ID:   "str1",
+			Type: "StringNode",
+			Data: map[string]interface{}{"value": "Test"},
+		},
+		{
+			ID:   "print1",
+			Type: "Print",
+			Data: map[string]interface{}{"label": "Print"},
+		},
+	}
+
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "print1"},
+		{ID: "e2", Source: "str1", Target: "print1", TargetPort: "value"},
+	}
+
+	compiler := NewGraphCompiler()
+	_, sourceMap, err := compiler.CompileToSource(nodes, edges)
+	if err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
+
+	raw, err := sourceMap.ToV3JSON()
+	if err != nil {
+		t.Fatalf("ToV3JSON failed: %v", err)
+	}
+
+	var doc struct {
+		Version  int      `json:"version"`
+		Sources  []string `json:"sources"`
+		Names    []string `json:"names"`
+		Mappings string   `json:"mappings"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("ToV3JSON did not produce valid JSON: %v", err)
+	}
+
+	if doc.Version != 3 {
+		t.Errorf("Expected version 3, got: %d", doc.Version)
+	}
+
+	if len(doc.Sources) != 1 || doc.Sources[0] != "print1" {
+		t.Errorf("Expected sources [print1], got: %v", doc.Sources)
+	}
+
+	if doc.Mappings == "" {
+		t.Error("Expected non-empty mappings string")
+	}
+}
+
 // TestTopologicalSorting tests execution order
 func TestTopologicalSorting(t *testing.T) {
 	// Create a graph: entry -> var1 -> print1
@@ -349,9 +328,9 @@ func TestTopologicalSorting(t *testing.T) {
 
 	edges := []Edge{
 		{ID: "e1", Source: "entry", Target: "var1"},
-		{ID: "e2", Source: "num1", Target: "var1"},
+		{ID: "e2", Source: "num1", Target: "var1", TargetPort: "value"},
 		{ID: "e3", Source: "var1", Target: "print1"},
-		{ID: "e4", Source: "getvar1", Target: "print1"},
+		{ID: "e4", Source: "getvar1", Target: "print1", TargetPort: "value"},
 	}
 
 	compiler := NewGraphCompiler()
@@ -392,9 +371,9 @@ func TestTopologicalSorting(t *testing.T) {
 	}
 }
 
-// TestArithmeticOperators tests arithmetic operator node compilation
-func TestArithmeticOperators(t *testing.T) {
-	// Create graph: 2 + 3
+// TestImportSourceModule tests that an Import node referencing a module
+// registered with RegisterModuleSource compiles to a plain import(...) call.
+func TestImportSourceModule(t *testing.T) {
 	nodes := []Node{
 		{
 			ID:   "entry",
@@ -402,124 +381,853 @@ func TestArithmeticOperators(t *testing.T) {
 			Data: map[string]interface{}{"label": "Start"},
 		},
 		{
-			ID:   "num1",
-			Type: "NumberNode",
-			Data: map[string]interface{}{"value": 2.0},
+			ID:   "import1",
+			Type: "Import",
+			Data: map[string]interface{}{"module": "mathutils", "alias": "mu"},
 		},
-		{
-			ID:   "num2",
-			Type: "NumberNode",
-			Data: map[string]interface{}{"value": 3.0},
+	}
+
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "import1"},
+	}
+
+	compiler := NewGraphCompiler()
+	compiler.RegisterModuleSource("mathutils", "export { sqrt: func(x) { return x } }")
+
+	source, _, err := compiler.CompileToSource(nodes, edges)
+	if err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
+
+	expectedSource := `mu := import("mathutils")`
+	if strings.TrimSpace(source) != expectedSource {
+		t.Errorf("Expected source:\n%s\nGot:\n%s", expectedSource, source)
+	}
+}
+
+// TestImportGraphModule tests that an Import node referencing a module
+// registered with RegisterModuleGraph inlines the subgraph as a
+// namespaced immediately-invoked function.
+func TestImportGraphModule(t *testing.T) {
+	moduleFlow := FlowData{
+		Nodes: []Node{
+			{ID: "mentry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+			{ID: "mstr", Type: "StringNode", Data: map[string]interface{}{"value": "hello from module"}},
+			{ID: "mprint", Type: "Print", Data: map[string]interface{}{"label": "Print"}},
 		},
-		{
-			ID:   "add1",
-			Type: "Add",
-			Data: map[string]interface{}{"label": "Add"},
+		Edges: []Edge{
+			{ID: "me1", Source: "mentry", Target: "mprint"},
+			{ID: "me2", Source: "mstr", Target: "mprint", TargetPort: "value"},
 		},
-		{
-			ID:   "print1",
-			Type: "Print",
-			Data: map[string]interface{}{"label": "Print"},
+	}
+
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "import1", Type: "Import", Data: map[string]interface{}{"module": "greeter", "alias": "g"}},
+	}
+
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "import1"},
+	}
+
+	compiler := NewGraphCompiler()
+	compiler.RegisterModuleGraph("greeter", moduleFlow)
+
+	source, sourceMap, err := compiler.CompileToSource(nodes, edges)
+	if err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
+
+	if !strings.Contains(source, "g := func() {") {
+		t.Errorf("Expected inlined module header in source, got:\n%s", source)
+	}
+	if !strings.Contains(source, `print("hello from module")`) {
+		t.Errorf("Expected inlined module body in source, got:\n%s", source)
+	}
+	if !strings.Contains(source, "}()") {
+		t.Errorf("Expected inlined module to close as an invoked function, got:\n%s", source)
+	}
+
+	// The inlined print line should carry the imported module's name as its module.
+	foundModuleMapping := false
+	for _, mapping := range sourceMap.Mappings {
+		if mapping.NodeID == "mprint" && mapping.Module == "greeter" {
+			foundModuleMapping = true
+			break
+		}
+	}
+	if !foundModuleMapping {
+		t.Error("Expected source map mapping for mprint tagged with module \"greeter\"")
+	}
+}
+
+// TestCyclicGraphModuleImport tests that a graph module that imports
+// itself (directly or transitively) is rejected instead of recursing
+// forever.
+func TestCyclicGraphModuleImport(t *testing.T) {
+	selfImportingFlow := FlowData{
+		Nodes: []Node{
+			{ID: "sentry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+			{ID: "simport", Type: "Import", Data: map[string]interface{}{"module": "cyclic", "alias": "self"}},
+		},
+		Edges: []Edge{
+			{ID: "se1", Source: "sentry", Target: "simport"},
 		},
 	}
 
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "import1", Type: "Import", Data: map[string]interface{}{"module": "cyclic", "alias": "c"}},
+	}
+
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "import1"},
+	}
+
+	compiler := NewGraphCompiler()
+	compiler.RegisterModuleGraph("cyclic", selfImportingFlow)
+
+	_, _, err := compiler.CompileToSource(nodes, edges)
+	if err == nil {
+		t.Fatal("Expected cyclic import to fail compilation")
+	}
+	if !strings.Contains(err.Error(), "cyclic import") {
+		t.Errorf("Expected error to mention cyclic import, got: %v", err)
+	}
+}
+
+// TestModuleMemberExpr tests that a ModuleMember node renders as member
+// access off the Import node wired into its "module" input.
+func TestModuleMemberExpr(t *testing.T) {
+	compiler := NewGraphCompiler()
+	compiler.nodes = map[string]*CompiledNode{
+		"import1": {
+			Node: Node{ID: "import1", Type: "Import", Data: map[string]interface{}{"module": "mathutils", "alias": "mu"}},
+		},
+		"mem1": {
+			Node:   Node{ID: "mem1", Type: "ModuleMember", Data: map[string]interface{}{"member": "sqrt"}},
+			Inputs: map[string]NodePort{"module": {NodeID: "import1", PortName: "output"}},
+		},
+	}
+
+	expr := compiler.buildExprForNode("mem1")
+	if got := printExpr(expr); got != "mu.sqrt" {
+		t.Errorf("Expected 'mu.sqrt', got: %s", got)
+	}
+}
+
+// TestVLQRoundTrip tests that encodeVLQ/decodeVLQ round-trip a range of
+// signed values, including the zero and negative edge cases.
+func TestVLQRoundTrip(t *testing.T) {
+	for _, value := range []int{0, 1, -1, 15, -15, 16, -16, 1000, -1000} {
+		encoded := encodeVLQ(value)
+		decoded, rest, err := decodeVLQ(encoded)
+		if err != nil {
+			t.Fatalf("decodeVLQ(%q) failed: %v", encoded, err)
+		}
+		if rest != "" {
+			t.Errorf("decodeVLQ(%q) left unconsumed remainder %q", encoded, rest)
+		}
+		if decoded != value {
+			t.Errorf("round-trip mismatch: encoded %d as %q, decoded back to %d", value, encoded, decoded)
+		}
+	}
+}
+
+// TestDecodeMappingsV3OptionalName tests that decodeMappingsV3 correctly
+// decodes a line mixing a 4-field segment (no name) and a 5-field
+// segment (with a name), a shape any Source Map v3 producer may emit.
+// SourceMap.ToV3JSON itself writes at most one segment per line, with a
+// fifth field only when that line's mapping has a NodePort.
+func TestDecodeMappingsV3OptionalName(t *testing.T) {
+	var mappings strings.Builder
+	mappings.WriteString(encodeVLQ(0)) // generatedColumn
+	mappings.WriteString(encodeVLQ(0)) // sourceIndex
+	mappings.WriteString(encodeVLQ(0)) // originalLine
+	mappings.WriteString(encodeVLQ(0)) // originalColumn
+	mappings.WriteByte(',')
+	mappings.WriteString(encodeVLQ(1)) // generatedColumn delta
+	mappings.WriteString(encodeVLQ(1)) // sourceIndex delta
+	mappings.WriteString(encodeVLQ(0)) // originalLine delta
+	mappings.WriteString(encodeVLQ(0)) // originalColumn delta
+	mappings.WriteString(encodeVLQ(2)) // nameIndex delta
+
+	lines, err := decodeMappingsV3(mappings.String())
+	if err != nil {
+		t.Fatalf("decodeMappingsV3 failed: %v", err)
+	}
+	if len(lines) != 1 || len(lines[0]) != 2 {
+		t.Fatalf("Expected one line with two segments, got: %v", lines)
+	}
+
+	if lines[0][0].HasName {
+		t.Error("Expected first segment to have no name")
+	}
+	if !lines[0][1].HasName || lines[0][1].NameIndex != 2 {
+		t.Errorf("Expected second segment to have nameIndex 2, got: %+v", lines[0][1])
+	}
+}
+
+// TestSourceMapV3RoundTripHelloWorld tests that decoding the V3 JSON
+// produced for the "Hello, World!" graph resolves the print line back to
+// the print node via Sources, matching FindMapping on the original
+// SourceMap.
+func TestSourceMapV3RoundTripHelloWorld(t *testing.T) {
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "str1", Type: "StringNode", Data: map[string]interface{}{"value": "Hello, World!"}},
+		{ID: "print1", Type: "Print", Data: map[string]interface{}{"label": "Print"}},
+	}
 	edges := []Edge{
 		{ID: "e1", Source: "entry", Target: "print1"},
-		{ID: "e2", Source: "num1", Target: "add1"}, // left input
-		{ID: "e3", Source: "num2", Target: "add1"}, // right input
-		{ID: "e4", Source: "add1", Target: "print1"},
+		{ID: "e2", Source: "str1", Target: "print1", TargetPort: "value"},
 	}
 
-	// Manually set up inputs for the Add node since port names matter
 	compiler := NewGraphCompiler()
-	compiler.buildGraph(nodes, edges)
+	_, sourceMap, err := compiler.CompileToSource(nodes, edges)
+	if err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
 
-	// Fix the Add node inputs to have both left and right
-	addNode := compiler.nodes["add1"]
-	addNode.Inputs["left"] = NodePort{NodeID: "num1", PortName: "value"}
-	addNode.Inputs["right"] = NodePort{NodeID: "num2", PortName: "value"}
+	raw, err := sourceMap.ToV3JSON()
+	if err != nil {
+		t.Fatalf("ToV3JSON failed: %v", err)
+	}
 
-	source, _, err := compiler.CompileToSource(nodes, edges)
+	var doc sourceMapV3
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("Invalid V3 JSON: %v", err)
+	}
 
+	lines, err := decodeMappingsV3(doc.Mappings)
+	if err != nil {
+		t.Fatalf("decodeMappingsV3 failed: %v", err)
+	}
+	if len(lines) != 1 || len(lines[0]) == 0 {
+		t.Fatalf("Expected one mapped line, got: %v", lines)
+	}
+
+	source := lines[0][0].SourceIndex
+	if source < 0 || source >= len(doc.Sources) || doc.Sources[source] != "print1" {
+		t.Errorf("Expected line 1 to map to print1, got source %v", doc.Sources)
+	}
+}
+
+// TestSourceMapV3RoundTripArithmetic tests the same decode round trip
+// against the arithmetic graph's print line.
+func TestSourceMapV3RoundTripArithmetic(t *testing.T) {
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "num1", Type: "NumberNode", Data: map[string]interface{}{"value": 2.0}},
+		{ID: "num2", Type: "NumberNode", Data: map[string]interface{}{"value": 3.0}},
+		{ID: "add1", Type: "Add", Data: map[string]interface{}{"label": "Add"}},
+		{ID: "print1", Type: "Print", Data: map[string]interface{}{"label": "Print"}},
+	}
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "print1"},
+		{ID: "e2", Source: "num1", Target: "add1", TargetPort: "left"},
+		{ID: "e3", Source: "num2", Target: "add1", TargetPort: "right"},
+		{ID: "e4", Source: "add1", Target: "print1", TargetPort: "value"},
+	}
+
+	compiler := NewGraphCompiler()
+	_, sourceMap, err := compiler.CompileToSource(nodes, edges)
 	if err != nil {
 		t.Fatalf("Compilation failed: %v", err)
 	}
 
-	if !strings.Contains(source, "print((2 + 3))") {
-		t.Errorf("Expected 'print((2 + 3))' in source, got:\n%s", source)
+	raw, err := sourceMap.ToV3JSON()
+	if err != nil {
+		t.Fatalf("ToV3JSON failed: %v", err)
+	}
+
+	var doc sourceMapV3
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("Invalid V3 JSON: %v", err)
+	}
+
+	// add1 is a legacy BinaryOp node, so it's consulted only as an
+	// expression inside the print line - it never owns a line of its own.
+	lines, err := decodeMappingsV3(doc.Mappings)
+	if err != nil {
+		t.Fatalf("decodeMappingsV3 failed: %v", err)
+	}
+	if len(lines) != 1 || len(lines[0]) == 0 {
+		t.Fatalf("Expected one mapped line, got: %v", lines)
+	}
+
+	source := lines[0][0].SourceIndex
+	if source < 0 || source >= len(doc.Sources) || doc.Sources[source] != "print1" {
+		t.Errorf("Expected line 1 to map to print1, got source %v", doc.Sources)
 	}
 }
 
-// TestMultipleOperators tests nested arithmetic operations
-func TestMultipleOperators(t *testing.T) {
-	// Create graph: (2 * 3) + 4
+// TestCompileGraphV3SourceMap tests that App.CompileGraph surfaces a
+// SourceMapV3 field alongside the generated source.
+func TestCompileGraphV3SourceMap(t *testing.T) {
+	app := NewApp()
+
 	nodes := []Node{
-		{
-			ID:   "entry",
-			Type: "EntryPoint",
-			Data: map[string]interface{}{"label": "Start"},
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "str1", Type: "StringNode", Data: map[string]interface{}{"value": "Test"}},
+		{ID: "print1", Type: "Print", Data: map[string]interface{}{"label": "Print"}},
+	}
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "print1"},
+		{ID: "e2", Source: "str1", Target: "print1", TargetPort: "value"},
+	}
+
+	nodesJSON, _ := json.Marshal(nodes)
+	edgesJSON, _ := json.Marshal(edges)
+
+	resultJSON := app.CompileGraph(string(nodesJSON), string(edgesJSON))
+
+	var result CompileGraphResult
+	if err := json.Unmarshal([]byte(resultJSON), &result); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+
+	if !result.Success {
+		t.Fatalf("Compilation failed: %s", result.ErrorMessage)
+	}
+
+	var v3 sourceMapV3
+	if err := json.Unmarshal(result.SourceMapV3, &v3); err != nil {
+		t.Fatalf("Failed to parse sourceMapV3: %v", err)
+	}
+
+	if v3.Version != 3 {
+		t.Errorf("Expected version 3, got: %d", v3.Version)
+	}
+}
+
+func TestGraphToDot(t *testing.T) {
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "str1", Type: "StringNode", Data: map[string]interface{}{"value": "Test"}},
+		{ID: "print1", Type: "Print", Data: map[string]interface{}{"label": "Print"}},
+	}
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "print1"},
+		{ID: "e2", Source: "str1", Target: "print1"},
+	}
+
+	compiler := NewGraphCompiler()
+	if err := compiler.buildGraph(nodes, edges); err != nil {
+		t.Fatalf("Build graph failed: %v", err)
+	}
+	if err := compiler.topologicalSort(); err != nil {
+		t.Fatalf("Topological sort failed: %v", err)
+	}
+
+	dot := string(compiler.Dot(&DotOpts{}))
+
+	if !strings.HasPrefix(dot, "digraph sox {") {
+		t.Errorf("Expected DOT output to start with \"digraph sox {\", got:\n%s", dot)
+	}
+
+	if !strings.Contains(dot, `"entry" [label="entry\nEntryPoint"];`) {
+		t.Errorf("Expected entry node label in DOT output, got:\n%s", dot)
+	}
+
+	if !strings.Contains(dot, `"entry" -> "print1" [style=dashed, color=black];`) {
+		t.Errorf("Expected dashed control-flow edge from entry, got:\n%s", dot)
+	}
+
+	if !strings.Contains(dot, `"str1" -> "print1" [style=solid, color=black];`) {
+		t.Errorf("Expected solid data-flow edge from str1, got:\n%s", dot)
+	}
+}
+
+func TestGraphToDotHighlightsDataCycle(t *testing.T) {
+	// Create a cycle: node1 -> node2 -> node1
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "node1", Type: "GetVar", Data: map[string]interface{}{"name": "x"}},
+		{ID: "node2", Type: "GetVar", Data: map[string]interface{}{"name": "y"}},
+	}
+
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "node1"},
+		{ID: "e2", Source: "node1", Target: "node2"},
+		{ID: "e3", Source: "node2", Target: "node1"}, // Creates cycle
+	}
+
+	compiler := NewGraphCompiler()
+	if err := compiler.buildGraph(nodes, edges); err != nil {
+		t.Fatalf("Build graph failed: %v", err)
+	}
+
+	dot := string(compiler.Dot(nil))
+
+	if !strings.Contains(dot, `"node2" -> "node1" [style=solid, color=red];`) {
+		t.Errorf("Expected the back edge of the data cycle in red, got:\n%s", dot)
+	}
+
+	if !strings.Contains(dot, `"node1" -> "node2" [style=solid, color=black];`) {
+		t.Errorf("Expected the non-cyclic leg of the cycle in black, got:\n%s", dot)
+	}
+}
+
+func TestGraphToDotCompiledOnly(t *testing.T) {
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "print1", Type: "Print", Data: map[string]interface{}{"label": "Print"}},
+		{ID: "orphan", Type: "GetVar", Data: map[string]interface{}{"name": "unused"}},
+	}
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "print1"},
+	}
+
+	compiler := NewGraphCompiler()
+	if err := compiler.buildGraph(nodes, edges); err != nil {
+		t.Fatalf("Build graph failed: %v", err)
+	}
+	if err := compiler.topologicalSort(); err != nil {
+		t.Fatalf("Topological sort failed: %v", err)
+	}
+
+	dot := string(compiler.Dot(&DotOpts{CompiledOnly: true}))
+
+	if strings.Contains(dot, "orphan") {
+		t.Errorf("Expected unreached node to be dropped from CompiledOnly export, got:\n%s", dot)
+	}
+}
+
+func TestAppGraphToDot(t *testing.T) {
+	app := NewApp()
+
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "print1", Type: "Print", Data: map[string]interface{}{"label": "Print"}},
+	}
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "print1"},
+	}
+
+	nodesJSON, _ := json.Marshal(nodes)
+	edgesJSON, _ := json.Marshal(edges)
+
+	dot, err := app.GraphToDot(string(nodesJSON), string(edgesJSON))
+	if err != nil {
+		t.Fatalf("GraphToDot failed: %v", err)
+	}
+
+	if !strings.Contains(dot, `"entry" -> "print1"`) {
+		t.Errorf("Expected entry -> print1 edge in DOT output, got:\n%s", dot)
+	}
+}
+
+func TestCompileGraphYAML(t *testing.T) {
+	app := NewApp()
+
+	nodesYAML := `
+- id: entry
+  type: EntryPoint
+  data:
+    label: Start
+- id: str1
+  type: StringNode
+  data:
+    value: Test
+- id: print1
+  type: Print
+  data:
+    label: Print
+`
+	edgesYAML := `
+- id: e1
+  source: entry
+  target: print1
+- id: e2
+  source: str1
+  target: print1
+  targetPort: value
+`
+
+	resultJSON := app.CompileGraphYAML(nodesYAML, edgesYAML)
+
+	var result CompileGraphResult
+	if err := json.Unmarshal([]byte(resultJSON), &result); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+
+	if !result.Success {
+		t.Fatalf("Compilation failed: %s", result.ErrorMessage)
+	}
+
+	if !strings.Contains(result.SourceCode, `print("Test")`) {
+		t.Errorf("Expected print(\"Test\") in source, got:\n%s", result.SourceCode)
+	}
+}
+
+func TestCompileGraphYAMLParseError(t *testing.T) {
+	app := NewApp()
+
+	badYAML := `
+- id: entry
+   type: EntryPoint
+`
+
+	resultJSON := app.CompileGraphYAML(badYAML, "[]")
+
+	var result CompileGraphResult
+	if err := json.Unmarshal([]byte(resultJSON), &result); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+
+	if result.Success {
+		t.Fatal("Expected malformed YAML to fail compilation")
+	}
+
+	if !strings.Contains(result.ErrorMessage, "nodes YAML") {
+		t.Errorf("Expected error to name the nodes document, got: %s", result.ErrorMessage)
+	}
+
+	if !strings.Contains(result.ErrorMessage, "line") {
+		t.Errorf("Expected error to reference a line number, got: %s", result.ErrorMessage)
+	}
+}
+
+// TestFunctionDefAndCall tests that a FunctionDef node compiles to a
+// func declaration whose params are drawn from Data["params"] and body
+// from the nested FlowData in Data["body"], and that a Call node
+// compiles to an invocation of it.
+func TestFunctionDefAndCall(t *testing.T) {
+	body := FlowData{
+		Nodes: []Node{
+			{ID: "bentry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+			{ID: "geta", Type: "GetVar", Data: map[string]interface{}{"name": "a"}},
+			{ID: "getb", Type: "GetVar", Data: map[string]interface{}{"name": "b"}},
+			{ID: "addop", Type: "BinaryOp", Data: map[string]interface{}{"op": "+"}},
+			{ID: "ret", Type: "Return"},
 		},
-		{
-			ID:   "num1",
-			Type: "NumberNode",
-			Data: map[string]interface{}{"value": 2.0},
+		Edges: []Edge{
+			{ID: "be1", Source: "bentry", Target: "ret"},
+			{ID: "be2", Source: "geta", Target: "addop", TargetPort: "left"},
+			{ID: "be3", Source: "getb", Target: "addop", TargetPort: "right"},
+			{ID: "be4", Source: "addop", Target: "ret", TargetPort: "value"},
 		},
-		{
-			ID:   "num2",
-			Type: "NumberNode",
-			Data: map[string]interface{}{"value": 3.0},
+	}
+
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "funcDef", Type: "FunctionDef", Data: map[string]interface{}{
+			"name":   "add",
+			"params": []interface{}{"a", "b"},
+			"body":   body,
+		}},
+		{ID: "num1", Type: "NumberNode", Data: map[string]interface{}{"value": 5.0}},
+		{ID: "num2", Type: "NumberNode", Data: map[string]interface{}{"value": 3.0}},
+		{ID: "call1", Type: "Call", Data: map[string]interface{}{"callee": "add"}},
+	}
+
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "funcDef"},
+		{ID: "e2", Source: "entry", Target: "call1"},
+		{ID: "e3", Source: "num1", Target: "call1", TargetPort: "arg0"},
+		{ID: "e4", Source: "num2", Target: "call1", TargetPort: "arg1"},
+	}
+
+	compiler := NewGraphCompiler()
+	source, _, err := compiler.CompileToSource(nodes, edges)
+	if err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
+
+	if !strings.Contains(source, "func add(a, b) {") {
+		t.Errorf("Expected function declaration in source, got:\n%s", source)
+	}
+	if !strings.Contains(source, "return (a + b)") {
+		t.Errorf("Expected return statement in source, got:\n%s", source)
+	}
+	if !strings.Contains(source, "add(5, 3)") {
+		t.Errorf("Expected call site in source, got:\n%s", source)
+	}
+}
+
+// TestClosureCapturesOuterParam tests that a FunctionDef nested inside
+// another FunctionDef's body, whose body references the outer function's
+// param, is compiled with that name listed in its closure capture clause
+// - but the outer FunctionDef itself, which only references its own
+// param, gets no capture clause.
+func TestClosureCapturesOuterParam(t *testing.T) {
+	innerBody := FlowData{
+		Nodes: []Node{
+			{ID: "ientry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+			{ID: "getx", Type: "GetVar", Data: map[string]interface{}{"name": "x"}},
+			{ID: "gety", Type: "GetVar", Data: map[string]interface{}{"name": "y"}},
+			{ID: "addop", Type: "BinaryOp", Data: map[string]interface{}{"op": "+"}},
+			{ID: "iret", Type: "Return"},
 		},
-		{
-			ID:   "num3",
-			Type: "NumberNode",
-			Data: map[string]interface{}{"value": 4.0},
+		Edges: []Edge{
+			{ID: "ie1", Source: "ientry", Target: "iret"},
+			{ID: "ie2", Source: "getx", Target: "addop", TargetPort: "left"},
+			{ID: "ie3", Source: "gety", Target: "addop", TargetPort: "right"},
+			{ID: "ie4", Source: "addop", Target: "iret", TargetPort: "value"},
 		},
-		{
-			ID:   "mul1",
-			Type: "Multiply",
-			Data: map[string]interface{}{"label": "Multiply"},
+	}
+
+	outerBody := FlowData{
+		Nodes: []Node{
+			{ID: "oentry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+			{ID: "innerFunc", Type: "FunctionDef", Data: map[string]interface{}{
+				"name":   "adder",
+				"params": []interface{}{"y"},
+				"body":   innerBody,
+			}},
+			{ID: "num5", Type: "NumberNode", Data: map[string]interface{}{"value": 5.0}},
+			{ID: "call1", Type: "Call", Data: map[string]interface{}{"callee": "adder"}},
+			{ID: "oret", Type: "Return"},
 		},
-		{
-			ID:   "add1",
-			Type: "Add",
-			Data: map[string]interface{}{"label": "Add"},
+		Edges: []Edge{
+			{ID: "oe1", Source: "oentry", Target: "innerFunc"},
+			{ID: "oe2", Source: "oentry", Target: "oret"},
+			{ID: "oe3", Source: "num5", Target: "call1", TargetPort: "arg0"},
+			{ID: "oe4", Source: "call1", Target: "oret", TargetPort: "value"},
 		},
-		{
-			ID:   "print1",
-			Type: "Print",
-			Data: map[string]interface{}{"label": "Print"},
+	}
+
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "outerFunc", Type: "FunctionDef", Data: map[string]interface{}{
+			"name":   "makeAdder",
+			"params": []interface{}{"x"},
+			"body":   outerBody,
+		}},
+	}
+
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "outerFunc"},
+	}
+
+	compiler := NewGraphCompiler()
+	source, _, err := compiler.CompileToSource(nodes, edges)
+	if err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
+
+	if !strings.Contains(source, "func makeAdder(x) {") {
+		t.Errorf("Expected outer function to have no capture clause, got:\n%s", source)
+	}
+	if !strings.Contains(source, "func adder[x](y) {") {
+		t.Errorf("Expected inner function to capture outer param x, got:\n%s", source)
+	}
+	if !strings.Contains(source, "return (x + y)") {
+		t.Errorf("Expected inner return statement in source, got:\n%s", source)
+	}
+	if !strings.Contains(source, "return adder(5)") {
+		t.Errorf("Expected outer return statement in source, got:\n%s", source)
+	}
+}
+
+// TestUnboundSymbolError tests that a GetVar referencing a name that was
+// never declared anywhere in scope is reported as an "unbound_symbol"
+// CompilationError with a suggestion listing the nearest declared names.
+func TestUnboundSymbolError(t *testing.T) {
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "var1", Type: "DeclareVar", Data: map[string]interface{}{"name": "known"}},
+		{ID: "num1", Type: "NumberNode", Data: map[string]interface{}{"value": 1.0}},
+		{ID: "getvar1", Type: "GetVar", Data: map[string]interface{}{"name": "missing"}},
+		{ID: "print1", Type: "Print", Data: map[string]interface{}{"label": "Print"}},
+	}
+
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "var1"},
+		{ID: "e2", Source: "num1", Target: "var1", TargetPort: "value"},
+		{ID: "e3", Source: "var1", Target: "print1"},
+		{ID: "e4", Source: "getvar1", Target: "print1", TargetPort: "value"},
+	}
+
+	compiler := NewGraphCompiler()
+	_, _, err := compiler.CompileToSource(nodes, edges)
+	if err == nil {
+		t.Fatal("Expected compilation to fail for an unbound symbol")
+	}
+	if !strings.Contains(err.Error(), "unbound_symbol") {
+		t.Errorf("Expected error to carry ErrorType unbound_symbol, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "unbound symbol: missing") {
+		t.Errorf("Expected error to name the missing symbol, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "known") {
+		t.Errorf("Expected error's suggestion to mention the nearest declared symbol, got: %v", err)
+	}
+}
+
+// TestIfStatement tests that an If node compiles to a conditional with a
+// then and an else branch, each drawn from its own nested FlowData.
+func TestIfStatement(t *testing.T) {
+	thenBody := FlowData{
+		Nodes: []Node{
+			{ID: "tentry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+			{ID: "tstr", Type: "StringNode", Data: map[string]interface{}{"value": "yes"}},
+			{ID: "tprint", Type: "Print", Data: map[string]interface{}{"label": "Print"}},
 		},
+		Edges: []Edge{
+			{ID: "te1", Source: "tentry", Target: "tprint"},
+			{ID: "te2", Source: "tstr", Target: "tprint", TargetPort: "value"},
+		},
+	}
+	elseBody := FlowData{
+		Nodes: []Node{
+			{ID: "eentry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+			{ID: "estr", Type: "StringNode", Data: map[string]interface{}{"value": "no"}},
+			{ID: "eprint", Type: "Print", Data: map[string]interface{}{"label": "Print"}},
+		},
+		Edges: []Edge{
+			{ID: "ee1", Source: "eentry", Target: "eprint"},
+			{ID: "ee2", Source: "estr", Target: "eprint", TargetPort: "value"},
+		},
+	}
+
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "cond1", Type: "BooleanNode", Data: map[string]interface{}{"value": true}},
+		{ID: "if1", Type: "If", Data: map[string]interface{}{"then": thenBody, "else": elseBody}},
 	}
 
 	edges := []Edge{
-		{ID: "e1", Source: "entry", Target: "print1"},
-		{ID: "e2", Source: "num1", Target: "mul1"},
-		{ID: "e3", Source: "num2", Target: "mul1"},
-		{ID: "e4", Source: "mul1", Target: "add1"},
-		{ID: "e5", Source: "num3", Target: "add1"},
-		{ID: "e6", Source: "add1", Target: "print1"},
+		{ID: "e1", Source: "entry", Target: "if1"},
+		{ID: "e2", Source: "cond1", Target: "if1", TargetPort: "cond"},
 	}
 
 	compiler := NewGraphCompiler()
-	compiler.buildGraph(nodes, edges)
+	source, _, err := compiler.CompileToSource(nodes, edges)
+	if err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
 
-	// Manually set up the binary operator inputs
-	mulNode := compiler.nodes["mul1"]
-	mulNode.Inputs["left"] = NodePort{NodeID: "num1", PortName: "value"}
-	mulNode.Inputs["right"] = NodePort{NodeID: "num2", PortName: "value"}
+	if !strings.Contains(source, "if true {") {
+		t.Errorf("Expected if header in source, got:\n%s", source)
+	}
+	if !strings.Contains(source, `print("yes")`) {
+		t.Errorf("Expected then branch in source, got:\n%s", source)
+	}
+	if !strings.Contains(source, "} else {") {
+		t.Errorf("Expected else header in source, got:\n%s", source)
+	}
+	if !strings.Contains(source, `print("no")`) {
+		t.Errorf("Expected else branch in source, got:\n%s", source)
+	}
+}
 
-	addNode := compiler.nodes["add1"]
-	addNode.Inputs["left"] = NodePort{NodeID: "mul1", PortName: "result"}
-	addNode.Inputs["right"] = NodePort{NodeID: "num3", PortName: "value"}
+// TestWhileStatement tests that a While node compiles to a loop whose
+// condition and body are drawn from the node's "cond" input and nested
+// "body" FlowData.
+func TestWhileStatement(t *testing.T) {
+	body := FlowData{
+		Nodes: []Node{
+			{ID: "bentry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+			{ID: "getI", Type: "GetVar", Data: map[string]interface{}{"name": "i"}},
+			{ID: "print1", Type: "Print", Data: map[string]interface{}{"label": "Print"}},
+		},
+		Edges: []Edge{
+			{ID: "be1", Source: "bentry", Target: "print1"},
+			{ID: "be2", Source: "getI", Target: "print1", TargetPort: "value"},
+		},
+	}
 
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "var1", Type: "DeclareVar", Data: map[string]interface{}{"name": "i"}},
+		{ID: "num1", Type: "NumberNode", Data: map[string]interface{}{"value": 0.0}},
+		{ID: "getCond", Type: "GetVar", Data: map[string]interface{}{"name": "i"}},
+		{ID: "num2", Type: "NumberNode", Data: map[string]interface{}{"value": 3.0}},
+		{ID: "cmp1", Type: "Compare", Data: map[string]interface{}{"op": "<"}},
+		{ID: "while1", Type: "While", Data: map[string]interface{}{"body": body}},
+	}
+
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "var1"},
+		{ID: "e2", Source: "num1", Target: "var1", TargetPort: "value"},
+		{ID: "e3", Source: "entry", Target: "while1"},
+		{ID: "e4", Source: "getCond", Target: "cmp1", TargetPort: "left"},
+		{ID: "e5", Source: "num2", Target: "cmp1", TargetPort: "right"},
+		{ID: "e6", Source: "cmp1", Target: "while1", TargetPort: "cond"},
+	}
+
+	compiler := NewGraphCompiler()
 	source, _, err := compiler.CompileToSource(nodes, edges)
+	if err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
 
+	if !strings.Contains(source, "while (i < 3) {") {
+		t.Errorf("Expected while header in source, got:\n%s", source)
+	}
+	if !strings.Contains(source, "print(i)") {
+		t.Errorf("Expected while body in source, got:\n%s", source)
+	}
+}
+
+// TestForStatementBodyOrder tests that a For node's body compiles in
+// dependency order even when the nested FlowData's node array lists the
+// body's Print before the SetVar increment it depends on - regression
+// coverage for compileSubFlowToBlock, which must topologically sort a
+// nested flow the same way the top-level graph does rather than walking
+// flow.Nodes in raw input order.
+func TestForStatementBodyOrder(t *testing.T) {
+	body := FlowData{
+		Nodes: []Node{
+			// printIt is listed before bentry/step1 on purpose: a naive
+			// walk of this slice would emit the print before the
+			// increment it's fed by, or miss the increment's ordering
+			// relative to other statements entirely.
+			{ID: "printIt", Type: "Print", Data: map[string]interface{}{"label": "Print"}},
+			{ID: "bentry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+			{ID: "step1", Type: "SetVar", Data: map[string]interface{}{"name": "i"}},
+			{ID: "getIAdd", Type: "GetVar", Data: map[string]interface{}{"name": "i"}},
+			{ID: "oneLit", Type: "NumberNode", Data: map[string]interface{}{"value": 1.0}},
+			{ID: "addOp", Type: "BinaryOp", Data: map[string]interface{}{"op": "+"}},
+			{ID: "getIPrint", Type: "GetVar", Data: map[string]interface{}{"name": "i"}},
+		},
+		Edges: []Edge{
+			{ID: "be1", Source: "bentry", Target: "step1"},
+			{ID: "be2", Source: "bentry", Target: "printIt"},
+			{ID: "be3", Source: "getIAdd", Target: "addOp", TargetPort: "left"},
+			{ID: "be4", Source: "oneLit", Target: "addOp", TargetPort: "right"},
+			{ID: "be5", Source: "addOp", Target: "step1", TargetPort: "value"},
+			{ID: "be6", Source: "getIPrint", Target: "printIt", TargetPort: "value"},
+		},
+	}
+
+	nodes := []Node{
+		{ID: "entry", Type: "EntryPoint", Data: map[string]interface{}{"label": "Start"}},
+		{ID: "num0", Type: "NumberNode", Data: map[string]interface{}{"value": 0.0}},
+		{ID: "declI", Type: "DeclareVar", Data: map[string]interface{}{"name": "i"}},
+		{ID: "getICond", Type: "GetVar", Data: map[string]interface{}{"name": "i"}},
+		{ID: "num3", Type: "NumberNode", Data: map[string]interface{}{"value": 3.0}},
+		{ID: "cmp1", Type: "Compare", Data: map[string]interface{}{"op": "<"}},
+		{ID: "for1", Type: "For", Data: map[string]interface{}{"body": body}},
+	}
+
+	edges := []Edge{
+		{ID: "e1", Source: "entry", Target: "declI"},
+		{ID: "e2", Source: "num0", Target: "declI", TargetPort: "value"},
+		{ID: "e3", Source: "entry", Target: "for1"},
+		{ID: "e4", Source: "getICond", Target: "cmp1", TargetPort: "left"},
+		{ID: "e5", Source: "num3", Target: "cmp1", TargetPort: "right"},
+		{ID: "e6", Source: "cmp1", Target: "for1", TargetPort: "cond"},
+	}
+
+	compiler := NewGraphCompiler()
+	source, _, err := compiler.CompileToSource(nodes, edges)
 	if err != nil {
 		t.Fatalf("Compilation failed: %v", err)
 	}
 
-	// Should contain nested expression
-	if !strings.Contains(source, "((2 * 3) + 4)") {
-		t.Errorf("Expected '((2 * 3) + 4)' in source, got:\n%s", source)
+	if !strings.Contains(source, "for ; (i < 3);  {") {
+		t.Errorf("Expected for header in source, got:\n%s", source)
+	}
+
+	incrementIdx := strings.Index(source, "i = (i + 1)")
+	printIdx := strings.Index(source, "print(i)")
+	if incrementIdx == -1 || printIdx == -1 {
+		t.Fatalf("Expected both the increment and the print in source, got:\n%s", source)
+	}
+	if incrementIdx >= printIdx {
+		t.Errorf("Expected the increment to compile before the print despite node array order, got:\n%s", source)
 	}
 }
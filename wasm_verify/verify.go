@@ -5,11 +5,13 @@ package main
 */
 import "C"
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
 	"strings"
 	"sync"
+	"time"
 	"unsafe"
 
 	"github.com/tetratelabs/wazero"
@@ -23,33 +25,87 @@ type OutputCapture struct {
 	mu     sync.Mutex
 }
 
-// Global output capture for the current execution
-var (
-	currentOutput *OutputCapture
-	outputMutex   sync.Mutex
-)
+// outputCaptureKey is the context key under which print_f64 finds its
+// sink. Keeping it in ctx (rather than a package global) is what lets two
+// verifications run concurrently.
+type outputCaptureKey struct{}
+
+// sharedCompilationCache is reused across runs so that repeated
+// verification of the same module (e.g. from the GraphCompiler test
+// pipeline) doesn't pay re-compilation cost on every call.
+var sharedCompilationCache = wazero.NewCompilationCache()
 
 // VerifyResult contains the result of WASM verification
 type VerifyResult struct {
 	Success bool
 	Error   string
 	Output  []float64
+	Stdout  string
+	Stderr  string
+}
+
+// WASMRunOptions configures resource limits and behavior for a single
+// WASM verification run.
+type WASMRunOptions struct {
+	// Timeout bounds the wall-clock time the module is allowed to run.
+	// Zero means no timeout.
+	Timeout time.Duration
+
+	// MaxInstructions approximates a fuel limit: once the host function
+	// call count (our proxy for instructions retired) crosses this
+	// threshold, the run's context is cancelled and wazero tears the
+	// module down (the runtime is built WithCloseOnContextDone). Zero
+	// means unlimited.
+	MaxInstructions uint64
+
+	// MaxMemoryPages caps the module's linear memory, in 64KiB pages.
+	// Zero means wazero's default limit applies.
+	MaxMemoryPages uint32
+
+	// CaptureStdout/CaptureStderr redirect the module's WASI stdout and
+	// stderr streams into VerifyResult.Stdout/Stderr instead of the
+	// host's own streams.
+	CaptureStdout bool
+	CaptureStderr bool
 }
 
-// print_f64 is the host function that Sox WASM modules import
-func print_f64(_ context.Context, m api.Module, value float64) {
-	outputMutex.Lock()
-	defer outputMutex.Unlock()
+// DefaultWASMRunOptions returns the resource limits used by the legacy
+// LoadAndExecuteWASM entry point: a generous but bounded 30s timeout and
+// no instruction or memory caps.
+func DefaultWASMRunOptions() WASMRunOptions {
+	return WASMRunOptions{
+		Timeout: 30 * time.Second,
+	}
+}
 
-	if currentOutput != nil {
-		currentOutput.mu.Lock()
-		defer currentOutput.mu.Unlock()
-		currentOutput.values = append(currentOutput.values, value)
+// print_f64 is the host function that Sox WASM modules import. It reads
+// its sink from ctx rather than a package global so that concurrent
+// verifications don't stomp on each other's output.
+func print_f64(ctx context.Context, m api.Module, value float64) {
+	spendFuel(ctx)
+
+	capture, _ := ctx.Value(outputCaptureKey{}).(*OutputCapture)
+	if capture == nil {
+		return
 	}
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	capture.values = append(capture.values, value)
 }
 
 // LoadAndExecuteWASM loads a WASM file and executes its main function
+// using the default resource limits. It is a thin wrapper around
+// LoadAndExecuteWASMWithOptions kept for existing callers.
 func LoadAndExecuteWASM(wasmPath string) (*VerifyResult, error) {
+	return LoadAndExecuteWASMWithOptions(context.Background(), wasmPath, DefaultWASMRunOptions())
+}
+
+// LoadAndExecuteWASMWithOptions loads a WASM file and executes its main
+// function under the resource limits described by opts. Unlike
+// LoadAndExecuteWASM, it is safe to call concurrently from multiple
+// goroutines: each call gets its own runtime, module instance, and
+// output sink.
+func LoadAndExecuteWASMWithOptions(ctx context.Context, wasmPath string, opts WASMRunOptions) (*VerifyResult, error) {
 	result := &VerifyResult{
 		Success: false,
 		Output:  []float64{},
@@ -72,26 +128,38 @@ func LoadAndExecuteWASM(wasmPath string) (*VerifyResult, error) {
 		return result, fmt.Errorf(result.Error)
 	}
 
-	// Create wazero runtime
-	ctx := context.Background()
-	r := wazero.NewRuntime(ctx)
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	// CloseOnContextDone makes a cancelled/expired ctx forcibly tear down
+	// an in-flight call instead of waiting for it to return on its own,
+	// which is what lets Timeout and MaxInstructions actually bound a
+	// runaway module rather than just racing it.
+	runtimeConfig := wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithCompilationCache(sharedCompilationCache)
+	if opts.MaxMemoryPages > 0 {
+		runtimeConfig = runtimeConfig.WithMemoryLimitPages(opts.MaxMemoryPages)
+	}
+
+	r := wazero.NewRuntimeWithConfig(ctx, runtimeConfig)
 	defer r.Close(ctx)
 
 	// Instantiate WASI to provide basic functionality
 	wasi_snapshot_preview1.MustInstantiate(ctx, r)
 
-	// Initialize output capture with thread safety
-	outputMutex.Lock()
-	currentOutput = &OutputCapture{
-		values: []float64{},
-	}
-	outputMutex.Unlock()
+	capture := &OutputCapture{values: []float64{}}
+	ctx = context.WithValue(ctx, outputCaptureKey{}, capture)
 
-	defer func() {
-		outputMutex.Lock()
-		currentOutput = nil
-		outputMutex.Unlock()
-	}()
+	if opts.MaxInstructions > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		ctx = withFuelLimit(ctx, opts.MaxInstructions, cancel)
+	}
 
 	// Create host module "env" with print_f64 function
 	_, err = r.NewHostModuleBuilder("env").
@@ -104,9 +172,17 @@ func LoadAndExecuteWASM(wasmPath string) (*VerifyResult, error) {
 		return result, err
 	}
 
+	moduleConfig := wazero.NewModuleConfig().WithName("sox_module")
+	var stdout, stderr bytes.Buffer
+	if opts.CaptureStdout {
+		moduleConfig = moduleConfig.WithStdout(&stdout)
+	}
+	if opts.CaptureStderr {
+		moduleConfig = moduleConfig.WithStderr(&stderr)
+	}
+
 	// Instantiate the WASM module
-	mod, err := r.InstantiateWithConfig(ctx, wasmBytes,
-		wazero.NewModuleConfig().WithName("sox_module"))
+	mod, err := r.InstantiateWithConfig(ctx, wasmBytes, moduleConfig)
 	if err != nil {
 		result.Error = fmt.Sprintf("failed to instantiate WASM module: %v", err)
 		return result, err
@@ -121,24 +197,71 @@ func LoadAndExecuteWASM(wasmPath string) (*VerifyResult, error) {
 	}
 
 	_, err = mainFunc.Call(ctx)
+	if opts.CaptureStdout {
+		result.Stdout = stdout.String()
+	}
+	if opts.CaptureStderr {
+		result.Stderr = stderr.String()
+	}
 	if err != nil {
-		result.Error = fmt.Sprintf("failed to execute main function: %v", err)
+		if ctx.Err() != nil {
+			result.Error = fmt.Sprintf("execution aborted: %v", ctx.Err())
+		} else {
+			result.Error = fmt.Sprintf("failed to execute main function: %v", err)
+		}
 		return result, err
 	}
 
-	// Success! Capture the output with thread safety
+	// Success! Capture the output.
 	result.Success = true
-	outputMutex.Lock()
-	if currentOutput != nil {
-		currentOutput.mu.Lock()
-		result.Output = make([]float64, len(currentOutput.values))
-		copy(result.Output, currentOutput.values)
-		currentOutput.mu.Unlock()
-	}
-	outputMutex.Unlock()
+	capture.mu.Lock()
+	result.Output = make([]float64, len(capture.values))
+	copy(result.Output, capture.values)
+	capture.mu.Unlock()
 	return result, nil
 }
 
+// fuelKey is the context key used by withFuelLimit to track the
+// remaining call budget for a single run.
+type fuelKey struct{}
+
+// fuelCounter tracks how many host-boundary calls a run has spent,
+// standing in for a true per-instruction fuel meter: wazero has no public
+// instruction-level counter, but every print_f64 call crosses the
+// host/guest boundary and so gives us a cheap, monotonic proxy.
+type fuelCounter struct {
+	remaining uint64
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+}
+
+// withFuelLimit attaches a fuel counter to ctx and returns the decorated
+// context. Host functions should call spendFuel to draw down the budget;
+// once it's exhausted cancel is invoked, which (combined with
+// WithCloseOnContextDone) forcibly tears down the in-flight call.
+func withFuelLimit(ctx context.Context, max uint64, cancel context.CancelFunc) context.Context {
+	return context.WithValue(ctx, fuelKey{}, &fuelCounter{remaining: max, cancel: cancel})
+}
+
+// spendFuel draws down the run's instruction budget and cancels the run
+// once it's exhausted. Host functions that can be invoked an unbounded
+// number of times (print_f64, future builtins) should call this.
+func spendFuel(ctx context.Context) {
+	fc, _ := ctx.Value(fuelKey{}).(*fuelCounter)
+	if fc == nil {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.remaining == 0 {
+		return
+	}
+	fc.remaining--
+	if fc.remaining == 0 {
+		fc.cancel()
+	}
+}
+
 // FormatOutput converts output values to a string representation
 func FormatOutput(values []float64) string {
 	if len(values) == 0 {
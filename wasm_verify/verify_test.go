@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// wasmModule assembles a minimal WASM binary (no toolchain required) with
+// a single imported host function "env.print_f64" (f64) -> () and a
+// single exported function "main" () -> () whose body is the given
+// instruction bytes.
+func wasmModule(t *testing.T, body []byte) []byte {
+	t.Helper()
+
+	section := func(id byte, content []byte) []byte {
+		return append([]byte{id}, append(leb128(uint32(len(content))), content...)...)
+	}
+	str := func(s string) []byte {
+		return append(leb128(uint32(len(s))), []byte(s)...)
+	}
+
+	// Type section: type0 (f64)->(), type1 ()->()
+	typeSec := section(1, append([]byte{0x02},
+		append([]byte{0x60, 0x01, 0x7c, 0x00}, []byte{0x60, 0x00, 0x00}...)...))
+
+	// Import section: func env.print_f64 : type0, becomes func index 0
+	importEntry := append(str("env"), append(str("print_f64"), []byte{0x00, 0x00}...)...)
+	importSec := section(2, append([]byte{0x01}, importEntry...))
+
+	// Function section: one function (func index 1 = "main") of type1
+	funcSec := section(3, []byte{0x01, 0x01})
+
+	// Export section: export func index 1 as "main"
+	exportEntry := append(str("main"), []byte{0x00, 0x01}...)
+	exportSec := section(7, append([]byte{0x01}, exportEntry...))
+
+	// Code section: one function body, no locals, given instructions, end.
+	funcBody := append([]byte{0x00}, append(body, 0x0b)...)
+	codeEntry := append(leb128(uint32(len(funcBody))), funcBody...)
+	codeSec := section(10, append([]byte{0x01}, codeEntry...))
+
+	var out []byte
+	out = append(out, 0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00) // magic + version
+	out = append(out, typeSec...)
+	out = append(out, importSec...)
+	out = append(out, funcSec...)
+	out = append(out, exportSec...)
+	out = append(out, codeSec...)
+	return out
+}
+
+// leb128 encodes an unsigned 32-bit integer as unsigned LEB128, the
+// varint form every WASM binary section/vector length uses.
+func leb128(v uint32) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if v == 0 {
+			return out
+		}
+	}
+}
+
+func writeWASMFile(t *testing.T, wasm []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "module.wasm")
+	if err := os.WriteFile(path, wasm, 0o644); err != nil {
+		t.Fatalf("failed to write WASM file: %v", err)
+	}
+	return path
+}
+
+// finiteModule calls print_f64(1) exactly once, then returns - used
+// wherever a test just needs a fast, well-behaved module.
+func finiteModule(t *testing.T) []byte {
+	t.Helper()
+	body := append([]byte{0x44}, f64ConstBits(1)...)
+	body = append(body, 0x10, 0x00) // call func index 0 (print_f64)
+	return wasmModule(t, body)
+}
+
+// infiniteModule loops forever calling print_f64(0) on every iteration -
+// used to exercise Timeout and MaxInstructions cancellation, since
+// neither limit has anything else to race against.
+func infiniteModule(t *testing.T) []byte {
+	t.Helper()
+	body := []byte{0x03, 0x40} // loop (blocktype empty)
+	body = append(body, 0x44)
+	body = append(body, f64ConstBits(0)...)
+	body = append(body, 0x10, 0x00) // call func index 0
+	body = append(body, 0x0c, 0x00) // br 0 (back to loop start)
+	body = append(body, 0x0b)       // end loop
+	return wasmModule(t, body)
+}
+
+func f64ConstBits(v float64) []byte {
+	bits := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bits, math.Float64bits(v))
+	return bits
+}
+
+func TestConcurrentVerification(t *testing.T) {
+	path := writeWASMFile(t, finiteModule(t))
+
+	const runs = 20
+	var wg sync.WaitGroup
+	errs := make([]error, runs)
+	results := make([]*VerifyResult, runs)
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = LoadAndExecuteWASMWithOptions(context.Background(), path, DefaultWASMRunOptions())
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < runs; i++ {
+		if errs[i] != nil {
+			t.Fatalf("run %d: unexpected error: %v", i, errs[i])
+		}
+		if !results[i].Success {
+			t.Fatalf("run %d: expected success, got error: %s", i, results[i].Error)
+		}
+		if len(results[i].Output) != 1 || results[i].Output[0] != 1 {
+			t.Errorf("run %d: expected output [1], got: %v", i, results[i].Output)
+		}
+	}
+}
+
+func TestTimeoutCancelsRunawayModule(t *testing.T) {
+	path := writeWASMFile(t, infiniteModule(t))
+
+	start := time.Now()
+	result, err := LoadAndExecuteWASMWithOptions(context.Background(), path, WASMRunOptions{
+		Timeout: 50 * time.Millisecond,
+	})
+	elapsed := time.Since(start)
+
+	if err == nil || result.Success {
+		t.Fatal("expected the runaway module to fail once its timeout expired")
+	}
+	if !strings.Contains(result.Error, "execution aborted") {
+		t.Errorf("expected an \"execution aborted\" error, got: %s", result.Error)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("expected the timeout to bound execution, took: %v", elapsed)
+	}
+}
+
+func TestMaxInstructionsCancelsRunawayModule(t *testing.T) {
+	path := writeWASMFile(t, infiniteModule(t))
+
+	start := time.Now()
+	result, err := LoadAndExecuteWASMWithOptions(context.Background(), path, WASMRunOptions{
+		Timeout:         5 * time.Second,
+		MaxInstructions: 10,
+	})
+	elapsed := time.Since(start)
+
+	if err == nil || result.Success {
+		t.Fatal("expected the runaway module to fail once its instruction budget ran out")
+	}
+	if !strings.Contains(result.Error, "execution aborted") {
+		t.Errorf("expected an \"execution aborted\" error, got: %s", result.Error)
+	}
+	if elapsed >= 5*time.Second {
+		t.Errorf("expected MaxInstructions to cancel the run well before the 5s timeout, took: %v", elapsed)
+	}
+}